@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"load-balancer/internal/balancer"
+	"load-balancer/internal/config"
+	"load-balancer/internal/logger"
+	"load-balancer/pkg/storage"
+)
+
+// newLoadBalancer создает балансировщик. Если пул бэкендов сохраняется в хранилище,
+// он восстанавливается оттуда, а пустое хранилище заполняется бэкендами из конфигурации
+func newLoadBalancer(cfg *config.Config, store storage.Storage, log *logger.Logger) (*balancer.LoadBalancer, error) {
+	if !cfg.Storage.PersistBackends {
+		return balancer.NewLoadBalancer(cfg.Backends, cfg.Balancer, log)
+	}
+
+	stored, err := store.LoadAllBackends()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки пула бэкендов: %w", err)
+	}
+
+	if len(stored) == 0 {
+		lb, err := balancer.NewLoadBalancer(cfg.Backends, cfg.Balancer, log)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, backend := range lb.BackendConfigs() {
+			if err := store.SaveBackend(storage.Backend{URL: backend.URL, Weight: backend.Weight, Enabled: true}); err != nil {
+				return nil, fmt.Errorf("ошибка сохранения пула бэкендов: %w", err)
+			}
+		}
+		lb.SetStorage(store)
+		return lb, nil
+	}
+
+	// Переопределения проверки здоровья хранятся только в файле конфигурации
+	overrides := make(map[string]config.BackendHealthCheckConfig, len(cfg.Backends))
+	for _, backend := range cfg.Backends {
+		overrides[backend.URL] = backend.HealthCheck
+	}
+
+	backends := make([]config.BackendConfig, 0, len(stored))
+	for _, backend := range stored {
+		backends = append(backends, config.BackendConfig{
+			URL:         backend.URL,
+			Weight:      backend.Weight,
+			HealthCheck: overrides[backend.URL],
+		})
+	}
+
+	lb, err := balancer.NewLoadBalancer(backends, cfg.Balancer, log)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, backend := range stored {
+		if backend.Enabled {
+			continue
+		}
+
+		parsed, err := url.Parse(backend.URL)
+		if err != nil {
+			return nil, fmt.Errorf("неверный формат URL %s: %v", backend.URL, err)
+		}
+		if err := lb.SetBackendEnabled(parsed.Host, false); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Infof("Пул из %d бэкендов восстановлен из хранилища", len(backends))
+	lb.SetStorage(store)
+	return lb, nil
+}
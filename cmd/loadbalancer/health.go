@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"load-balancer/internal/balancer"
+	"load-balancer/internal/config"
+	"load-balancer/internal/health"
+	"load-balancer/pkg/storage"
+)
+
+// newReadinessChecks создает проверки готовности балансировщика: он не завершает
+// работу, доступно достаточно бэкендов и хранилище отвечает
+func newReadinessChecks(cfg config.HealthConfig, lb *balancer.LoadBalancer, store storage.Storage) *health.Checker {
+	checker := health.NewChecker()
+
+	checker.AddCheck("draining", func(ctx context.Context) error {
+		if lb.IsDraining() {
+			return errors.New("load balancer is shutting down")
+		}
+		return nil
+	})
+
+	checker.AddCheck("backends", func(ctx context.Context) error {
+		servers := lb.Servers()
+		available := 0
+		for _, server := range servers {
+			if server.IsAvailable() {
+				available++
+			}
+		}
+
+		if available < cfg.MinHealthyBackends {
+			return fmt.Errorf("%d of %d backends available, at least %d required", available, len(servers), cfg.MinHealthyBackends)
+		}
+		return nil
+	})
+
+	checker.AddCheck("storage", func(ctx context.Context) error {
+		if err := store.Ping(ctx); err != nil {
+			return errors.New("storage is unreachable")
+		}
+		return nil
+	})
+
+	return checker
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"load-balancer/internal/config"
+	"load-balancer/internal/logger"
+)
+
+// newLogger создает логгер по настройкам. Если вывод идет в файл, возвращается
+// и io.Closer для его закрытия, иначе nil
+func newLogger(cfg config.LoggingConfig) (*logger.Logger, io.Closer, error) {
+	level, err := logger.ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var output *os.File
+	var closer io.Closer
+	switch cfg.Output {
+	case "stdout":
+		output = os.Stdout
+	case "stderr":
+		output = os.Stderr
+	default:
+		output, err = os.OpenFile(cfg.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ошибка открытия файла лога: %w", err)
+		}
+		closer = output
+	}
+
+	colors := isTerminal(output)
+	if cfg.Colors != nil {
+		colors = *cfg.Colors
+	}
+
+	return logger.NewLoggerWithOptions(logger.Options{
+		Level:  level,
+		Format: logger.Format(cfg.Format),
+		Colors: colors,
+		Output: output,
+	}), closer, nil
+}
+
+// isTerminal проверяет, что вывод идет в терминал
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// sameLoggingOutput проверяет, что настройки вывода логов не изменились
+func sameLoggingOutput(a, b config.LoggingConfig) bool {
+	if a.Format != b.Format || a.Output != b.Output {
+		return false
+	}
+	if a.Colors == nil || b.Colors == nil {
+		return a.Colors == b.Colors
+	}
+	return *a.Colors == *b.Colors
+}
@@ -11,10 +11,15 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"load-balancer/internal/accesslog"
 	"load-balancer/internal/balancer"
 	"load-balancer/internal/config"
 	"load-balancer/internal/logger"
+	"load-balancer/internal/metrics"
+	"load-balancer/internal/tracing"
+	"load-balancer/pkg/clientip"
 	"load-balancer/pkg/ratelimiter"
+	"load-balancer/pkg/requestid"
 	"load-balancer/pkg/storage"
 )
 
@@ -32,8 +37,25 @@ func main() {
 		log.Fatalf("Ошибка загрузки конфигурации: %v", err)
 	}
 
+	// Дальше пишем в лог с настройками из конфигурации
+	configured, logFile, err := newLogger(cfg.Logging)
+	if err != nil {
+		log.Fatalf("Ошибка настройки логирования: %v", err)
+	}
+	log = configured
+
+	// Трассировка OpenTelemetry
+	shutdownTracing, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Ошибка настройки трассировки: %v", err)
+	}
+	if cfg.Tracing.Enabled {
+		log.Infof("Трассировка включена, экспортер: %s", cfg.Tracing.Exporter)
+	}
+
 	// Инициализация хранилища
 	var store storage.Storage
+	var pgStorage *storage.PostgresStorage
 	if cfg.Storage.Type == "postgres" {
 		pgConfig := storage.Config{
 			Host:     cfg.Storage.Postgres.Host,
@@ -44,11 +66,10 @@ func main() {
 			SSLMode:  cfg.Storage.Postgres.SSLMode,
 		}
 
-		pgStorage, err := storage.NewPostgresStorage(pgConfig)
+		pgStorage, err = storage.NewPostgresStorage(pgConfig)
 		if err != nil {
 			log.Fatalf("Ошибка инициализации PostgreSQL: %v", err)
 		}
-		defer pgStorage.Close()
 		store = pgStorage
 
 		log.Info("Подключено к PostgreSQL")
@@ -57,20 +78,25 @@ func main() {
 		store = storage.NewMemoryStorage()
 	}
 
+	// Метрики Prometheus
+	var promMetrics *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		promMetrics = metrics.New(cfg.Metrics.MaxClients)
+		store = promMetrics.InstrumentStorage(store)
+	}
+
 	// Создание балансировщика
-	lb, err := balancer.NewLoadBalancer(cfg.Backends, cfg.Balancer.Algorithm, log)
+	lb, err := newLoadBalancer(cfg, store, log)
 	if err != nil {
 		log.Fatalf("Ошибка создания балансировщика: %v", err)
 	}
 
 	// Настройка проверки здоровья
-	hc := balancer.NewHealthChecker(
-		lb.Servers(),
-		cfg.HealthCheck.Interval,
-		cfg.HealthCheck.Endpoint,
-		log,
-	)
-	hc.Start()
+	hc, err := balancer.NewHealthChecker(lb.Servers(), cfg.HealthCheck, log)
+	if err != nil {
+		log.Fatalf("Ошибка настройки проверки здоровья: %v", err)
+	}
+	lb.OnServersChange(hc.SetServers)
 
 	// Создание rate limiter
 	limiter := ratelimiter.NewRateLimiter(
@@ -79,6 +105,50 @@ func main() {
 		log,
 		store,
 	)
+	if err := limiter.SetDefaultAlgorithm(cfg.RateLimit.Default.Algorithm); err != nil {
+		log.Fatalf("Ошибка настройки rate limiter: %v", err)
+	}
+
+	// В распределенном режиме ведра токенов общие для всех экземпляров
+	var tokenStore storage.TokenStore
+	var ownTokenStore bool
+	if cfg.RateLimit.Distributed.Enabled {
+		tokenStore, ownTokenStore, err = newTokenStore(cfg, pgStorage)
+		if err != nil {
+			log.Fatalf("Ошибка подключения хранилища распределенного rate limiting: %v", err)
+		}
+		if promMetrics != nil {
+			tokenStore = promMetrics.InstrumentTokenStore(tokenStore)
+		}
+		limiter.SetShared(ratelimiter.SharedOptions{
+			Store:     tokenStore,
+			KeyPrefix: cfg.RateLimit.Distributed.KeyPrefix,
+			BatchSize: cfg.RateLimit.Distributed.BatchSize,
+			Timeout:   cfg.RateLimit.Distributed.Timeout,
+		})
+		log.Infof("Распределенное ограничение частоты запросов включено, хранилище: %s", cfg.RateLimit.Distributed.Backend)
+	}
+
+	if promMetrics != nil {
+		lb.SetMetrics(promMetrics)
+		hc.SetMetrics(promMetrics)
+		limiter.SetMetrics(promMetrics)
+		promMetrics.RegisterBalancer(lb)
+		promMetrics.RegisterRateLimiter(limiter)
+	}
+
+	hc.Start()
+
+	// Перезагрузка конфигурации по SIGHUP и при изменении файла
+	reload := &reloader{
+		path:    *configPath,
+		current: cfg,
+		lb:      lb,
+		hc:      hc,
+		limiter: limiter,
+		log:     log,
+	}
+	go reload.run(cfg.Reload)
 
 	// Создаем маршрутизатор для API
 	router := mux.NewRouter()
@@ -86,20 +156,73 @@ func main() {
 	// Регистрируем маршруты для управления клиентами
 	limiter.RegisterClientRoutes(router)
 
+	// Регистрируем маршруты балансировщика
+	lb.RegisterRoutes(router)
+
+	// Регистрируем маршруты управления уровнем логирования
+	log.RegisterRoutes(router)
+
 	// Создаем мультиплексор для обработки разных типов запросов
 	mainMux := http.NewServeMux()
 
 	// Запросы к API обрабатываются через router
 	mainMux.Handle("/clients", router)
 	mainMux.Handle("/clients/", router)
+	mainMux.Handle("/circuit-breakers", router)
+	mainMux.Handle("/backends", router)
+	mainMux.Handle("/backends/", router)
+	mainMux.Handle("/log-level", router)
+
+	// Liveness и readiness обслуживаются без ограничения частоты запросов.
+	// Готовность снимается в начале завершения работы, до остановки приема запросов
+	readiness := newReadinessChecks(cfg.Health, lb, store)
+	mainMux.HandleFunc(cfg.Health.LivenessPath, readiness.LivenessHandler)
+	mainMux.HandleFunc(cfg.Health.ReadinessPath, readiness.ReadinessHandler)
+
+	if promMetrics != nil {
+		mainMux.Handle(cfg.Metrics.Path, promMetrics.Handler())
+	}
 
 	// Все остальные запросы проходят через rate limiter и направляются на балансировщик
-	mainMux.Handle("/", ratelimiter.RateLimitMiddleware(limiter)(lb))
+	var proxyHandler http.Handler = ratelimiter.RateLimitMiddleware(limiter)(lb)
+	proxyHandler = tracing.Middleware(proxyHandler)
+
+	// Access log оборачивает rate limiter, чтобы отклоненные запросы тоже попадали в журнал
+	var accessLog *accesslog.Logger
+	if cfg.AccessLog.Enabled {
+		accessLog, err = accesslog.New(cfg.AccessLog, limiter.ClientID, log)
+		if err != nil {
+			log.Fatalf("Ошибка инициализации access log: %v", err)
+		}
+		proxyHandler = accessLog.Middleware(proxyHandler)
+	}
+	mainMux.Handle("/", proxyHandler)
+
+	// Идентификатор назначается каждому запросу до всех остальных обработчиков,
+	// чтобы попасть в логи, access log и ответы с ошибками
+	trustedNetworks, err := clientip.ParseNetworks(cfg.RequestID.TrustedNetworks)
+	if err != nil {
+		log.Fatalf("Ошибка настройки X-Request-ID: %v", err)
+	}
+	// Адрес клиента определяется один раз для rate limiter, хеширования по IP и access log
+	trustedProxies, err := clientip.ParseNetworks(cfg.ClientIP.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Ошибка настройки доверенных прокси: %v", err)
+	}
+	var handler http.Handler = clientip.Middleware(clientip.Options{
+		TrustedProxies: trustedProxies,
+		IPv4Prefix:     cfg.ClientIP.IPv4Prefix,
+		IPv6Prefix:     cfg.ClientIP.IPv6Prefix,
+	})(mainMux)
+	handler = requestid.Middleware(requestid.Options{
+		TrustIncoming:   cfg.RequestID.TrustIncoming,
+		TrustedNetworks: trustedNetworks,
+	})(handler)
 
 	// Создание HTTP-сервера с новым обработчиком
 	server := &http.Server{
 		Addr:    ":" + cfg.Server.Port,
-		Handler: mainMux,
+		Handler: handler,
 	}
 
 	go func() {
@@ -117,12 +240,57 @@ func main() {
 
 	log.Info("Завершение работы сервера...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// Паузы берутся из действующей конфигурации: они могли измениться при перезагрузке
+	current := reload.config()
+
+	// Сначала сообщаем о неготовности и ждем, пока внешний балансировщик перестанет слать запросы
+	lb.StartDraining()
+	if current.Shutdown.PreStopDelay > 0 {
+		log.Infof("Ожидание %v перед остановкой приема запросов", current.Shutdown.PreStopDelay)
+		time.Sleep(current.Shutdown.PreStopDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), current.Balancer.DrainTimeout)
 	defer cancel()
 
+	// Shutdown прекращает прием соединений и ждет завершения обработчиков,
+	// WaitIdle - еще и соединений, захваченных после Upgrade
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Ошибка при завершении работы сервера: %v", err)
+		log.Errorf("Ошибка при завершении работы сервера: %v", err)
+	}
+	if err := lb.WaitIdle(ctx); err != nil {
+		log.Warnf("Не все запросы к бэкендам завершены: %v", err)
+	}
+
+	hc.Stop()
+	limiter.Stop()
+
+	if err := store.Close(); err != nil {
+		log.Errorf("Ошибка закрытия хранилища: %v", err)
+	}
+
+	if ownTokenStore {
+		if err := tokenStore.Close(); err != nil {
+			log.Errorf("Ошибка закрытия хранилища распределенного rate limiting: %v", err)
+		}
+	}
+
+	if accessLog != nil {
+		if err := accessLog.Close(); err != nil {
+			log.Errorf("Ошибка закрытия access log: %v", err)
+		}
+	}
+
+	// Отправляем накопленные спаны до выхода
+	tracingCtx, tracingCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer tracingCancel()
+	if err := shutdownTracing(tracingCtx); err != nil {
+		log.Errorf("Ошибка завершения трассировки: %v", err)
 	}
 
 	log.Info("Сервер остановлен")
+
+	if logFile != nil {
+		logFile.Close()
+	}
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"load-balancer/internal/config"
+	"load-balancer/pkg/storage"
+)
+
+// newTokenStore подключает общее хранилище ведер токенов для распределенного
+// ограничения частоты. Подключение к PostgreSQL из секции storage используется
+// повторно; owned сообщает, что хранилище открыто здесь и его нужно закрыть
+func newTokenStore(cfg *config.Config, pgStorage *storage.PostgresStorage) (store storage.TokenStore, owned bool, err error) {
+	distributed := cfg.RateLimit.Distributed
+
+	if distributed.Backend == "postgres" {
+		if pgStorage != nil {
+			return pgStorage, false, nil
+		}
+		pgStorage, err := storage.NewPostgresStorage(storage.Config{
+			Host:     cfg.Storage.Postgres.Host,
+			Port:     cfg.Storage.Postgres.Port,
+			User:     cfg.Storage.Postgres.User,
+			Password: cfg.Storage.Postgres.Password,
+			DBName:   cfg.Storage.Postgres.DBName,
+			SSLMode:  cfg.Storage.Postgres.SSLMode,
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		return pgStorage, true, nil
+	}
+
+	redisStore, err := storage.NewRedisTokenStore(storage.RedisConfig{
+		Address:  distributed.Redis.Address,
+		Password: distributed.Redis.Password,
+		DB:       distributed.Redis.DB,
+		PoolSize: distributed.Redis.PoolSize,
+		Timeout:  distributed.Timeout,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return redisStore, true, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"load-balancer/internal/balancer"
+	"load-balancer/internal/config"
+	"load-balancer/internal/logger"
+	"load-balancer/pkg/ratelimiter"
+)
+
+// reloader применяет изменения файла конфигурации без перезапуска процесса
+type reloader struct {
+	path    string
+	current *config.Config
+	lb      *balancer.LoadBalancer
+	hc      *balancer.HealthChecker
+	limiter *ratelimiter.RateLimiter
+	log     *logger.Logger
+	mutex   sync.Mutex
+}
+
+// config возвращает действующую конфигурацию с учетом перезагрузок
+func (r *reloader) config() *config.Config {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.current
+}
+
+// reload перечитывает конфигурацию и применяет ее. Все настройки проверяются до
+// применения, поэтому при ошибке продолжает действовать прежняя конфигурация
+// целиком, а не ее часть
+func (r *reloader) reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cfg, err := config.LoadConfig(r.path)
+	if err != nil {
+		return err
+	}
+
+	// Проверяем все части до того, как что-либо применить
+	healthCheck, err := balancer.NewHealthCheckSettings(cfg.HealthCheck)
+	if err != nil {
+		return err
+	}
+	if !ratelimiter.IsAlgorithm(cfg.RateLimit.Default.Algorithm) {
+		return fmt.Errorf("неизвестный алгоритм ограничения: %s", cfg.RateLimit.Default.Algorithm)
+	}
+
+	// Пул, сохраняемый в хранилище, управляется через API, а не файлом конфигурации
+	backends := cfg.Backends
+	if r.current.Storage.PersistBackends {
+		backends = r.lb.BackendConfigs()
+	}
+
+	// Reload балансировщика проверяет пул и настройки и применяет их атомарно,
+	// поэтому выполняется первым: после него ошибок быть не может. Список
+	// серверов HealthChecker получает от балансировщика сам
+	if err := r.lb.Reload(backends, cfg.Balancer); err != nil {
+		return err
+	}
+
+	r.hc.Apply(healthCheck)
+	r.limiter.SetDefaultAlgorithm(cfg.RateLimit.Default.Algorithm) // Алгоритм проверен выше
+	r.limiter.SetDefaults(cfg.RateLimit.Default.Capacity, cfg.RateLimit.Default.RefillRate)
+
+	// Уровень меняем, только если он изменился в файле, чтобы не сбросить
+	// уровень, установленный через API
+	if cfg.Logging.Level != r.current.Logging.Level {
+		level, _ := logger.ParseLevel(cfg.Logging.Level)
+		r.log.SetLevel(level)
+	}
+
+	if cfg.Server != r.current.Server || cfg.Storage != r.current.Storage || cfg.Reload != r.current.Reload ||
+		!sameLoggingOutput(cfg.Logging, r.current.Logging) ||
+		!reflect.DeepEqual(cfg.AccessLog, r.current.AccessLog) || !reflect.DeepEqual(cfg.RequestID, r.current.RequestID) ||
+		!reflect.DeepEqual(cfg.ClientIP, r.current.ClientIP) ||
+		!reflect.DeepEqual(cfg.Tracing, r.current.Tracing) || cfg.RateLimit.Distributed != r.current.RateLimit.Distributed {
+		r.log.Warn("Изменения настроек сервера, хранилища, перезагрузки, вывода логов, access log, X-Request-ID, доверенных прокси, трассировки и распределенного rate limiting вступят в силу только после перезапуска")
+	}
+	r.current = cfg
+
+	return nil
+}
+
+// run перезагружает конфигурацию по сигналу SIGHUP и, если включено,
+// при изменении файла конфигурации
+func (r *reloader) run(cfg config.ReloadConfig) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var changed <-chan time.Time
+	var modTime time.Time
+	if cfg.Watch {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		changed = ticker.C
+		modTime = r.modTime()
+	}
+
+	for {
+		select {
+		case <-hup:
+			r.log.Info("Получен сигнал SIGHUP, перезагрузка конфигурации")
+		case <-changed:
+			current := r.modTime()
+			if current.IsZero() || current.Equal(modTime) {
+				continue
+			}
+			modTime = current
+			r.log.Info("Файл конфигурации изменен, перезагрузка конфигурации")
+		}
+
+		if err := r.reload(); err != nil {
+			r.log.Errorf("Ошибка перезагрузки конфигурации, продолжает действовать прежняя: %v", err)
+			continue
+		}
+		r.log.Info("Конфигурация перезагружена")
+	}
+}
+
+// modTime возвращает время изменения файла конфигурации
+func (r *reloader) modTime() time.Time {
+	path := r.path
+	if envConfig := os.Getenv("CONFIG"); envConfig != "" {
+		path = envConfig
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,226 @@
+package accesslog
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"load-balancer/internal/config"
+	"load-balancer/internal/logger"
+	"load-balancer/pkg/clientip"
+	"load-balancer/pkg/requestid"
+)
+
+// StatusAborted код в записи о запросе, ответ на который оборвался (например,
+// клиент закрыл соединение посреди тела). Как в nginx, используется 499; в
+// bytes_out записывается отправленная часть ответа
+const StatusAborted = 499
+
+// ClientIDFunc определяет идентификатор клиента запроса
+type ClientIDFunc func(r *http.Request) string
+
+// Entry содержит данные одной записи access log. Балансировщик дополняет ее
+// сведениями о бэкенде через FromContext
+type Entry struct {
+	Time            time.Time
+	ClientID        string
+	ClientIP        string
+	Method          string
+	URI             string // Путь с параметрами запроса
+	Path            string
+	Proto           string
+	Status          int
+	BytesIn         int64
+	BytesOut        int64
+	Upstream        string        // Бэкенд последней попытки
+	UpstreamLatency time.Duration // Время ответа бэкенда в последней попытке
+	Latency         time.Duration // Полное время обработки запроса
+	Retries         int
+	RequestID       string
+	Referer         string
+	UserAgent       string
+
+	attempts int
+}
+
+// entryKey ключ записи в контексте запроса
+type entryKey struct{}
+
+// FromContext возвращает запись access log запроса или nil, если access log выключен
+func FromContext(ctx context.Context) *Entry {
+	entry, _ := ctx.Value(entryKey{}).(*Entry)
+	return entry
+}
+
+// RecordAttempt учитывает попытку проксирования на бэкенд
+func (e *Entry) RecordAttempt(upstream string, latency time.Duration) {
+	e.attempts++
+	e.Retries = e.attempts - 1
+	e.Upstream = upstream
+	e.UpstreamLatency = latency
+}
+
+// Logger пишет access log в выбранном формате
+type Logger struct {
+	format     formatter
+	output     io.Writer
+	closer     io.Closer // nil для stdout и stderr
+	sampleRate float64   // Доля записываемых успешных запросов
+	clientID   ClientIDFunc
+	mutex      sync.Mutex
+}
+
+// New создает access log по настройкам. Ошибки ротации файла записываются в log
+func New(cfg config.AccessLogConfig, clientID ClientIDFunc, log *logger.Logger) (*Logger, error) {
+	format, err := newFormatter(cfg.Format, cfg.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Logger{
+		format:     format,
+		sampleRate: 1,
+		clientID:   clientID,
+	}
+
+	if cfg.SuccessSampleRate != nil {
+		l.sampleRate = *cfg.SuccessSampleRate
+	}
+
+	switch cfg.Output {
+	case "stdout":
+		l.output = os.Stdout
+	case "stderr":
+		l.output = os.Stderr
+	default:
+		file, err := newRotatingFile(cfg.Output, cfg.MaxSizeMB*1024*1024, cfg.MaxBackups, log)
+		if err != nil {
+			return nil, err
+		}
+		l.output = file
+		l.closer = file
+	}
+
+	return l, nil
+}
+
+// Close закрывает файл access log
+func (l *Logger) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.closer.Close()
+}
+
+// Middleware записывает строку access log для каждого запроса
+func (l *Logger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		entry := &Entry{
+			Time:      start,
+			ClientID:  l.clientID(r),
+			ClientIP:  clientip.FromRequest(r),
+			Method:    r.Method,
+			URI:       r.URL.RequestURI(),
+			Path:      r.URL.Path,
+			Proto:     r.Proto,
+			RequestID: requestid.FromContext(r.Context()),
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = body
+		}
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+
+		// Запись делается в defer: ReverseProxy прерывает обработчик паникой
+		// http.ErrAbortHandler, когда ответ обрывается на середине тела
+		defer func() {
+			entry.Status = rw.status
+			entry.BytesIn = body.n
+			entry.BytesOut = rw.n
+			entry.Latency = time.Since(start)
+
+			if err := recover(); err != nil {
+				entry.Status = StatusAborted
+				l.write(entry)
+				panic(err)
+			}
+			l.write(entry)
+		}()
+
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), entryKey{}, entry)))
+	})
+}
+
+// write форматирует и записывает запись с учетом сэмплирования успешных запросов
+func (l *Logger) write(entry *Entry) {
+	if entry.Status < http.StatusBadRequest && l.sampleRate < 1 && rand.Float64() >= l.sampleRate {
+		return
+	}
+
+	line := l.format(entry)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.output.Write(line)
+}
+
+// countingReader считает байты, прочитанные из тела запроса
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// responseWriter запоминает код ответа и считает отправленные байты
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	n           int64
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.status = statusCode
+		// Промежуточные ответы 1xx не являются итоговыми
+		w.wroteHeader = statusCode >= http.StatusOK || statusCode == http.StatusSwitchingProtocols
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Flush нужен ReverseProxy для потоковых ответов
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap позволяет http.ResponseController добраться до исходного ResponseWriter,
+// например для Hijack при проксировании WebSocket
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
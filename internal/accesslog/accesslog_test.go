@@ -0,0 +1,179 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"load-balancer/internal/config"
+	"load-balancer/internal/logger"
+	"load-balancer/pkg/requestid"
+)
+
+func newTestLogger(t *testing.T, cfg config.AccessLogConfig) (*Logger, string) {
+	t.Helper()
+	cfg.Output = filepath.Join(t.TempDir(), "access.log")
+	l, err := New(cfg, func(r *http.Request) string { return r.Header.Get("X-API-Key") }, logger.NewLoggerWithLevel(logger.FatalLevel, io.Discard))
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	return l, cfg.Output
+}
+
+func TestMiddlewareJSON(t *testing.T) {
+	l, path := newTestLogger(t, config.AccessLogConfig{Format: "json"})
+
+	trusted := requestid.Middleware(requestid.Options{TrustIncoming: true})
+	handler := trusted(l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := FromContext(r.Context())
+		require.NotNil(t, entry)
+		entry.RecordAttempt("backend1:80", 10*time.Millisecond)
+		entry.RecordAttempt("backend2:80", 20*time.Millisecond)
+		io.Copy(io.Discard, r.Body)
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders?id=1", strings.NewReader("payload"))
+	req.Header.Set("X-API-Key", "client1")
+	req.Header.Set("X-Request-ID", "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &entry))
+	assert.Equal(t, "client1", entry["client_id"])
+	assert.Equal(t, "POST", entry["method"])
+	assert.Equal(t, "/orders", entry["path"])
+	assert.Equal(t, "/orders?id=1", entry["uri"])
+	assert.Equal(t, float64(201), entry["status"])
+	assert.Equal(t, float64(7), entry["bytes_in"])
+	assert.Equal(t, float64(7), entry["bytes_out"])
+	assert.Equal(t, "backend2:80", entry["upstream"])
+	assert.Equal(t, float64(20), entry["upstream_latency_ms"])
+	assert.Equal(t, float64(1), entry["retries"])
+	assert.Equal(t, "req-1", entry["request_id"])
+}
+
+func TestMiddlewareAbortedResponse(t *testing.T) {
+	l, path := newTestLogger(t, config.AccessLogConfig{Format: "json"})
+	handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic(http.ErrAbortHandler)
+	}))
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &entry))
+	assert.Equal(t, float64(StatusAborted), entry["status"])
+	assert.Equal(t, float64(7), entry["bytes_out"])
+}
+
+func TestCombinedAndTemplateFormats(t *testing.T) {
+	entry := &Entry{
+		Time:      time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		ClientID:  "client1",
+		ClientIP:  "10.0.0.1",
+		Method:    "GET",
+		URI:       "/a?b=c",
+		Proto:     "HTTP/1.1",
+		Status:    429,
+		UserAgent: "curl/8.0",
+		Upstream:  "backend1:80",
+	}
+
+	assert.Equal(t, `10.0.0.1 - - [01/Mar/2024:12:00:00 +0000] "GET /a?b=c HTTP/1.1" 429 - "" "curl/8.0"`+"\n",
+		string(formatCombined(entry)))
+
+	format, err := newFormatter("template", "{{.ClientID}} {{.Status}} {{.Upstream}}")
+	require.NoError(t, err)
+	assert.Equal(t, "client1 429 backend1:80\n", string(format(entry)))
+
+	_, err = newFormatter("template", "{{.Unclosed")
+	assert.Error(t, err)
+}
+
+func TestSuccessSampling(t *testing.T) {
+	rate := 0.0
+	l, path := newTestLogger(t, config.AccessLogConfig{Format: "template", Template: "{{.Status}}", SuccessSampleRate: &rate})
+
+	for _, status := range []int{200, 302, 404, 502} {
+		handler := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "404\n502\n", string(data))
+}
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := newRotatingFile(path, 10, 2, logger.NewLoggerWithLevel(logger.FatalLevel, io.Discard))
+	require.NoError(t, err)
+	defer f.Close()
+
+	for i := 0; i < 4; i++ {
+		_, err := f.Write([]byte(fmt.Sprintf("line%d\n", i)))
+		require.NoError(t, err)
+	}
+
+	for name, want := range map[string]string{path: "line3\n", path + ".1": "line2\n", path + ".2": "line1\n"} {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRotationFailureKeepsWriting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	var logs bytes.Buffer
+	f, err := newRotatingFile(path, 10, 1, logger.NewLoggerWithLevel(logger.InfoLevel, &logs))
+	require.NoError(t, err)
+	defer f.Close()
+
+	// Непустой каталог на месте path.1 не дает переименовать текущий файл
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "busy"), 0755))
+
+	for i := 0; i < 3; i++ {
+		_, err := f.Write([]byte(fmt.Sprintf("line%d\n", i)))
+		require.NoError(t, err)
+	}
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "line0\nline1\nline2\n", string(data), "строки не теряются")
+	assert.Equal(t, 1, strings.Count(logs.String(), "Не удалось выполнить ротацию access log"))
+
+	// Когда препятствие устранено, ротация выполняется при следующей записи
+	require.NoError(t, os.RemoveAll(path+".1"))
+	_, err = f.Write([]byte("line3\n"))
+	require.NoError(t, err)
+
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "line3\n", string(data))
+	assert.Contains(t, logs.String(), "Ротация access log восстановлена")
+}
@@ -0,0 +1,117 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// formatter форматирует запись в строку access log с переводом строки
+type formatter func(entry *Entry) []byte
+
+// combinedTimeLayout формат времени Apache
+const combinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// newFormatter создает форматер: "combined" (Apache), "json" или "template"
+func newFormatter(format, tmpl string) (formatter, error) {
+	switch format {
+	case "combined":
+		return formatCombined, nil
+	case "json":
+		return formatJSON, nil
+	case "template":
+		t, err := template.New("accesslog").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка разбора шаблона access log: %w", err)
+		}
+		return templateFormatter(t), nil
+	default:
+		return nil, fmt.Errorf("неизвестный формат access log: %s", format)
+	}
+}
+
+// formatCombined форматирует запись в Apache combined log format
+func formatCombined(e *Entry) []byte {
+	bytesOut := "-"
+	if e.BytesOut > 0 {
+		bytesOut = strconv.FormatInt(e.BytesOut, 10)
+	}
+
+	return []byte(fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s %s %s\n",
+		e.ClientIP,
+		e.Time.Format(combinedTimeLayout),
+		e.Method, e.URI, e.Proto,
+		e.Status,
+		bytesOut,
+		strconv.Quote(e.Referer),
+		strconv.Quote(e.UserAgent),
+	))
+}
+
+// jsonEntry запись access log в формате JSON
+type jsonEntry struct {
+	Time              string  `json:"time"`
+	ClientID          string  `json:"client_id"`
+	ClientIP          string  `json:"client_ip"`
+	Method            string  `json:"method"`
+	Path              string  `json:"path"`
+	URI               string  `json:"uri"`
+	Proto             string  `json:"protocol"`
+	Status            int     `json:"status"`
+	BytesIn           int64   `json:"bytes_in"`
+	BytesOut          int64   `json:"bytes_out"`
+	Upstream          string  `json:"upstream,omitempty"`
+	UpstreamLatencyMs float64 `json:"upstream_latency_ms"`
+	LatencyMs         float64 `json:"latency_ms"`
+	Retries           int     `json:"retries"`
+	RequestID         string  `json:"request_id,omitempty"`
+	Referer           string  `json:"referer,omitempty"`
+	UserAgent         string  `json:"user_agent,omitempty"`
+}
+
+// formatJSON форматирует запись как JSON-объект в одну строку
+func formatJSON(e *Entry) []byte {
+	data, _ := json.Marshal(jsonEntry{
+		Time:              e.Time.Format(time.RFC3339Nano),
+		ClientID:          e.ClientID,
+		ClientIP:          e.ClientIP,
+		Method:            e.Method,
+		Path:              e.Path,
+		URI:               e.URI,
+		Proto:             e.Proto,
+		Status:            e.Status,
+		BytesIn:           e.BytesIn,
+		BytesOut:          e.BytesOut,
+		Upstream:          e.Upstream,
+		UpstreamLatencyMs: milliseconds(e.UpstreamLatency),
+		LatencyMs:         milliseconds(e.Latency),
+		Retries:           e.Retries,
+		RequestID:         e.RequestID,
+		Referer:           e.Referer,
+		UserAgent:         e.UserAgent,
+	})
+	return append(data, '\n')
+}
+
+// templateFormatter форматирует запись по шаблону text/template с полями Entry
+func templateFormatter(t *template.Template) formatter {
+	return func(e *Entry) []byte {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, e); err != nil {
+			buf.Reset()
+			fmt.Fprintf(&buf, "access log template error: %v", err)
+		}
+		if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes()
+	}
+}
+
+// milliseconds переводит длительность в миллисекунды
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
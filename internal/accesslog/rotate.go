@@ -0,0 +1,125 @@
+package accesslog
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"load-balancer/internal/logger"
+)
+
+// rotatingFile пишет в файл и переименовывает его в path.1, path.2, ... при
+// достижении максимального размера, оставляя не больше maxBackups старых файлов
+type rotatingFile struct {
+	path       string
+	maxSize    int64 // 0 - без ротации
+	maxBackups int
+	file       *os.File
+	size       int64
+	renamed    bool // Текущий файл уже переименован, но новый еще не открыт
+	failing    bool // Последняя ротация не удалась
+	logger     *logger.Logger
+	mutex      sync.Mutex
+}
+
+// newRotatingFile открывает файл для дозаписи
+func newRotatingFile(path string, maxSize int64, maxBackups int, log *logger.Logger) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+		logger:     log,
+	}
+
+	file, size, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f.file = file
+	f.size = size
+	return f, nil
+}
+
+// openFile открывает файл для дозаписи и возвращает его размер
+func openFile(path string) (*os.File, int64, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ошибка открытия файла access log: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("ошибка открытия файла access log: %w", err)
+	}
+	return file, info.Size(), nil
+}
+
+// Write реализует io.Writer. Если ротация не удалась, запись продолжается в
+// прежний файл, а ротация повторяется при следующей записи
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			if !f.failing {
+				f.logger.Errorw("Не удалось выполнить ротацию access log, запись продолжается в прежний файл",
+					"path", f.path, "error", err)
+				f.failing = true
+			}
+		} else if f.failing {
+			f.logger.Infow("Ротация access log восстановлена", "path", f.path)
+			f.failing = false
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate сдвигает старые файлы и начинает новый. Прежний файл закрывается только
+// после того, как новый открыт
+func (f *rotatingFile) rotate() error {
+	if !f.renamed {
+		if err := f.shift(); err != nil {
+			return err
+		}
+		f.renamed = true
+	}
+
+	file, size, err := openFile(f.path)
+	if err != nil {
+		return err
+	}
+	f.renamed = false
+
+	if err := f.file.Close(); err != nil {
+		f.logger.Warnw("Ошибка закрытия прежнего файла access log", "path", f.path, "error", err)
+	}
+	f.file = file
+	f.size = size
+	return nil
+}
+
+// shift переименовывает текущий файл в path.1, сдвигая старые, или удаляет его,
+// если старые файлы не хранятся
+func (f *rotatingFile) shift() error {
+	if f.maxBackups == 0 {
+		return os.Remove(f.path)
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxBackups))
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	return os.Rename(f.path, f.path+".1")
+}
+
+// Close закрывает файл
+func (f *rotatingFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.file.Close()
+}
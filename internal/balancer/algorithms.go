@@ -1,6 +1,8 @@
 package balancer
 
 import (
+	"math/rand"
+	"net/http"
 	"sync"
 )
 
@@ -18,7 +20,7 @@ func NewRoundRobin() *RoundRobin {
 }
 
 // NextServer выбирает следующий сервер по Round Robin
-func (rr *RoundRobin) NextServer(servers []*Server) *Server {
+func (rr *RoundRobin) NextServer(servers []*Server, r *http.Request) *Server {
 	if len(servers) == 0 {
 		return nil
 	}
@@ -32,7 +34,7 @@ func (rr *RoundRobin) NextServer(servers []*Server) *Server {
 		rr.current = (rr.current + 1) % len(servers)
 		server := servers[rr.current]
 
-		if server.IsHealthy() {
+		if usable(server, r) {
 			return server
 		}
 
@@ -45,6 +47,50 @@ func (rr *RoundRobin) NextServer(servers []*Server) *Server {
 	return nil
 }
 
+// WeightedRoundRobin реализует плавный взвешенный Round Robin (как в nginx):
+// серверы чередуются пропорционально весам без пачек подряд идущих запросов
+type WeightedRoundRobin struct {
+	mutex sync.Mutex
+}
+
+// NewWeightedRoundRobin создает новый WeightedRoundRobin
+func NewWeightedRoundRobin() *WeightedRoundRobin {
+	return &WeightedRoundRobin{}
+}
+
+// NextServer выбирает следующий сервер с учетом весов
+func (wrr *WeightedRoundRobin) NextServer(servers []*Server, r *http.Request) *Server {
+	if len(servers) == 0 {
+		return nil
+	}
+
+	wrr.mutex.Lock()
+	defer wrr.mutex.Unlock()
+
+	var best *Server
+	total := 0
+
+	for _, server := range servers {
+		if !usable(server, r) {
+			continue
+		}
+
+		server.currentWeight += server.Weight
+		total += server.Weight
+
+		if best == nil || server.currentWeight > best.currentWeight {
+			best = server
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+
+	best.currentWeight -= total
+	return best
+}
+
 // LeastConnections реализует алгоритм выбора сервера с наименьшим количеством соединений
 type LeastConnections struct{}
 
@@ -54,20 +100,20 @@ func NewLeastConnections() *LeastConnections {
 }
 
 // NextServer выбирает сервер с наименьшим количеством активных соединений
-func (lc *LeastConnections) NextServer(servers []*Server) *Server {
+func (lc *LeastConnections) NextServer(servers []*Server, r *http.Request) *Server {
 	if len(servers) == 0 {
 		return nil
 	}
 
 	var minServer *Server
-	minConnections := -1
+	var minConnections int64
 
 	for _, server := range servers {
-		if !server.IsHealthy() {
+		if !usable(server, r) {
 			continue
 		}
 
-		connections := server.ActiveConnections
+		connections := server.ActiveConnections()
 
 		if minServer == nil || connections < minConnections {
 			minConnections = connections
@@ -77,3 +123,141 @@ func (lc *LeastConnections) NextServer(servers []*Server) *Server {
 
 	return minServer
 }
+
+// LeastLatency выбирает сервер с наименьшей оценкой стоимости:
+// peak EWMA задержки, умноженная на количество запросов в обработке
+type LeastLatency struct{}
+
+// NewLeastLatency создает новый LeastLatency
+func NewLeastLatency() *LeastLatency {
+	return &LeastLatency{}
+}
+
+// NextServer выбирает сервер с минимальной стоимостью
+func (ll *LeastLatency) NextServer(servers []*Server, r *http.Request) *Server {
+	if len(servers) == 0 {
+		return nil
+	}
+
+	latencies := make([]float64, len(servers))
+	sampled := make([]bool, len(servers))
+
+	// Нейтральная оценка для новых серверов - средняя задержка по измеренным
+	var total float64
+	var count int
+	for i, server := range servers {
+		if !usable(server, r) {
+			continue
+		}
+
+		latency, ok := server.Latency()
+		latencies[i], sampled[i] = float64(latency), ok
+		if ok {
+			total += float64(latency)
+			count++
+		}
+	}
+
+	neutral := 0.0
+	if count > 0 {
+		neutral = total / float64(count)
+	}
+
+	var best *Server
+	var bestCost float64
+
+	for i, server := range servers {
+		if !usable(server, r) {
+			continue
+		}
+
+		latency := latencies[i]
+		if !sampled[i] {
+			latency = neutral
+		}
+
+		// +1 учитывает сам выбираемый запрос, чтобы при нулевой нагрузке сравнивалась задержка
+		cost := latency * float64(server.ActiveConnections()+1)
+		if best == nil || cost < bestCost {
+			best = server
+			bestCost = cost
+		}
+	}
+
+	return best
+}
+
+// PowerOfTwoChoices выбирает два случайных сервера и берет менее загруженный.
+// Не использует блокировок и не сканирует весь пул на каждом запросе
+type PowerOfTwoChoices struct{}
+
+// NewPowerOfTwoChoices создает новый PowerOfTwoChoices
+func NewPowerOfTwoChoices() *PowerOfTwoChoices {
+	return &PowerOfTwoChoices{}
+}
+
+// NextServer выбирает из двух случайных серверов тот, у которого меньше запросов в обработке
+func (p *PowerOfTwoChoices) NextServer(servers []*Server, r *http.Request) *Server {
+	if len(servers) == 0 {
+		return nil
+	}
+	if len(servers) == 1 {
+		return randomHealthy(servers, r)
+	}
+
+	// Два различных случайных индекса
+	i := rand.Intn(len(servers))
+	j := rand.Intn(len(servers) - 1)
+	if j >= i {
+		j++
+	}
+
+	first, second := servers[i], servers[j]
+	firstHealthy, secondHealthy := usable(first, r), usable(second, r)
+
+	switch {
+	case firstHealthy && secondHealthy:
+		if second.ActiveConnections() < first.ActiveConnections() {
+			return second
+		}
+		return first
+	case firstHealthy:
+		return first
+	case secondHealthy:
+		return second
+	default:
+		// Оба кандидата недоступны - ищем любой здоровый сервер
+		return randomHealthy(servers, r)
+	}
+}
+
+// Random выбирает случайный доступный сервер
+type Random struct{}
+
+// NewRandom создает новый Random
+func NewRandom() *Random {
+	return &Random{}
+}
+
+// NextServer выбирает случайный доступный сервер
+func (rnd *Random) NextServer(servers []*Server, r *http.Request) *Server {
+	return randomHealthy(servers, r)
+}
+
+// randomHealthy выбирает здоровый сервер равновероятно. Выборка с резервуаром
+// проходит список один раз: k-й подходящий сервер заменяет выбранный с
+// вероятностью 1/k, поэтому сервер после недоступных не выбирается чаще других
+func randomHealthy(servers []*Server, r *http.Request) *Server {
+	var selected *Server
+	count := 0
+	for _, server := range servers {
+		if !usable(server, r) {
+			continue
+		}
+		count++
+		if rand.Intn(count) == 0 {
+			selected = server
+		}
+	}
+	return selected
+}
@@ -0,0 +1,197 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"load-balancer/internal/config"
+)
+
+// newTestServer создает здоровый сервер для тестов алгоритмов
+func newTestServer(host string, weight int) *Server {
+	server := &Server{
+		URL:    &url.URL{Scheme: "http", Host: host},
+		Weight: weight,
+	}
+	server.SetHealth(true)
+	return server
+}
+
+func TestWeightedRoundRobinDistribution(t *testing.T) {
+	servers := []*Server{
+		newTestServer("a", 5),
+		newTestServer("b", 1),
+		newTestServer("c", 1),
+	}
+
+	wrr := NewWeightedRoundRobin()
+
+	var sequence []string
+	for i := 0; i < 7; i++ {
+		sequence = append(sequence, wrr.NextServer(servers, nil).URL.Host)
+	}
+
+	// Плавное чередование как в nginx: тяжелый сервер не получает пачку запросов подряд
+	assert.Equal(t, []string{"a", "a", "b", "a", "c", "a", "a"}, sequence)
+}
+
+func TestWeightedRoundRobinSkipsUnhealthy(t *testing.T) {
+	servers := []*Server{
+		newTestServer("a", 3),
+		newTestServer("b", 1),
+	}
+	servers[0].SetHealth(false)
+
+	wrr := NewWeightedRoundRobin()
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "b", wrr.NextServer(servers, nil).URL.Host)
+	}
+
+	servers[1].SetHealth(false)
+	assert.Nil(t, wrr.NextServer(servers, nil))
+}
+
+func TestRandomUniformWithUnhealthy(t *testing.T) {
+	servers := []*Server{
+		newTestServer("down1", 1),
+		newTestServer("down2", 1),
+		newTestServer("a", 1),
+		newTestServer("b", 1),
+	}
+	servers[0].SetHealth(false)
+	servers[1].SetHealth(false)
+
+	// Сервер сразу после недоступных не получает их долю: a и b делят поток поровну
+	const n = 20000
+	counts := make(map[string]int)
+	rnd := NewRandom()
+	for i := 0; i < n; i++ {
+		counts[rnd.NextServer(servers, nil).URL.Host]++
+	}
+	assert.Len(t, counts, 2)
+	assert.InDelta(t, 0.5, float64(counts["a"])/n, 0.03)
+	assert.InDelta(t, 0.5, float64(counts["b"])/n, 0.03)
+
+	servers[2].SetHealth(false)
+	servers[3].SetHealth(false)
+	assert.Nil(t, rnd.NextServer(servers, nil))
+}
+
+func TestConsistentHashAffinityAndRemap(t *testing.T) {
+	servers := []*Server{
+		newTestServer("a", 1),
+		newTestServer("b", 1),
+		newTestServer("c", 1),
+		newTestServer("d", 1),
+	}
+
+	keyFunc, err := newHashKeyFunc(config.HashKeyConfig{Source: "api-key"})
+	require.NoError(t, err)
+	ch := NewConsistentHash(keyFunc)
+
+	const keys = 2000
+	before := make(map[string]*Server, keys)
+	for i := 0; i < keys; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", fmt.Sprintf("key-%d", i))
+		before[req.Header.Get("X-API-Key")] = ch.NextServer(servers, req)
+
+		// Повторный запрос с тем же ключом попадает на тот же сервер
+		assert.Same(t, before[req.Header.Get("X-API-Key")], ch.NextServer(servers, req))
+	}
+
+	// Удаляем один сервер: перемещаться должны только его ключи
+	remaining := servers[:3]
+	moved := 0
+	for key, server := range before {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", key)
+		after := ch.NextServer(remaining, req)
+		if after != server {
+			moved++
+			assert.Same(t, servers[3], server, "переместился ключ, не принадлежавший удаленному серверу")
+		}
+	}
+	assert.InDelta(t, keys/4, moved, keys/10)
+}
+
+func TestConsistentHashSkipsUnhealthy(t *testing.T) {
+	servers := []*Server{
+		newTestServer("a", 1),
+		newTestServer("b", 1),
+	}
+
+	keyFunc, err := newHashKeyFunc(config.HashKeyConfig{Source: "ip"})
+	require.NoError(t, err)
+	ch := NewConsistentHash(keyFunc)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	first := ch.NextServer(servers, req)
+	first.SetHealth(false)
+
+	second := ch.NextServer(servers, req)
+	require.NotNil(t, second)
+	assert.NotSame(t, first, second)
+
+	// Смена порта не меняет ключ
+	req.RemoteAddr = "10.0.0.1:54321"
+	assert.Same(t, second, ch.NextServer(servers, req))
+}
+
+func TestPowerOfTwoChoicesPrefersLessLoaded(t *testing.T) {
+	servers := []*Server{
+		newTestServer("a", 1),
+		newTestServer("b", 1),
+	}
+	servers[0].activeConnections.Store(10)
+
+	p2c := NewPowerOfTwoChoices()
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, "b", p2c.NextServer(servers, nil).URL.Host)
+	}
+
+	servers[1].SetHealth(false)
+	assert.Equal(t, "a", p2c.NextServer(servers, nil).URL.Host)
+
+	servers[0].SetHealth(false)
+	assert.Nil(t, p2c.NextServer(servers, nil))
+}
+
+func TestLeastLatency(t *testing.T) {
+	servers := []*Server{
+		newTestServer("slow", 1),
+		newTestServer("fast", 1),
+		newTestServer("new", 1),
+	}
+	servers[0].ObserveLatency(300 * time.Millisecond)
+	servers[1].ObserveLatency(100 * time.Millisecond)
+
+	ll := NewLeastLatency()
+	assert.Equal(t, "fast", ll.NextServer(servers, nil).URL.Host)
+
+	// Нагрузка на быстрый сервер делает новый сервер (с нейтральной оценкой 200ms) выгоднее
+	servers[1].activeConnections.Store(2)
+	assert.Equal(t, "new", ll.NextServer(servers, nil).URL.Host)
+}
+
+func TestPeakEWMAReactsToSpikes(t *testing.T) {
+	server := newTestServer("a", 1)
+	server.ObserveLatency(10 * time.Millisecond)
+	server.ObserveLatency(500 * time.Millisecond)
+
+	latency, ok := server.Latency()
+	assert.True(t, ok)
+	assert.Equal(t, 500*time.Millisecond, latency)
+
+	// Снижение задержки учитывается плавно
+	server.ObserveLatency(10 * time.Millisecond)
+	latency, _ = server.Latency()
+	assert.Greater(t, latency, 400*time.Millisecond)
+}
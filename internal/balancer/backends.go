@@ -0,0 +1,239 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"load-balancer/internal/config"
+	"load-balancer/pkg/storage"
+)
+
+var (
+	// ErrBackendNotFound возвращается, если бэкенда с указанным адресом нет в пуле
+	ErrBackendNotFound = errors.New("бэкенд не найден")
+	// ErrBackendExists возвращается при добавлении бэкенда, адрес которого уже есть в пуле
+	ErrBackendExists = errors.New("бэкенд уже есть в пуле")
+)
+
+// BackendState административное состояние бэкенда
+type BackendState int32
+
+const (
+	BackendActive   BackendState = iota // Получает запросы
+	BackendDisabled                     // Выключен администратором
+	BackendDraining                     // Не получает новых запросов, ждет завершения текущих
+)
+
+// String возвращает название состояния для API
+func (s BackendState) String() string {
+	switch s {
+	case BackendActive:
+		return "active"
+	case BackendDisabled:
+		return "disabled"
+	case BackendDraining:
+		return "draining"
+	default:
+		return "unknown"
+	}
+}
+
+// State возвращает административное состояние сервера
+func (s *Server) State() BackendState {
+	return BackendState(s.state.Load())
+}
+
+// setState меняет административное состояние сервера
+func (s *Server) setState(state BackendState) {
+	s.state.Store(int32(state))
+}
+
+// OnServersChange регистрирует обработчик изменения списка серверов. Обработчик
+// вызывается под блокировкой балансировщика и не должен обращаться к нему
+func (lb *LoadBalancer) OnServersChange(listener func(servers []*Server)) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	lb.listeners = append(lb.listeners, listener)
+}
+
+// notify сообщает обработчикам новый список серверов; вызывается под мьютексом
+func (lb *LoadBalancer) notify() {
+	for _, listener := range lb.listeners {
+		listener(lb.servers)
+	}
+}
+
+// SetStorage включает сохранение пула бэкендов в хранилище. Изменения,
+// сделанные до вызова, не сохраняются
+func (lb *LoadBalancer) SetStorage(store storage.Storage) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	lb.store = store
+}
+
+// BackendConfigs возвращает настройки бэкендов текущего пула
+func (lb *LoadBalancer) BackendConfigs() []config.BackendConfig {
+	lb.mutex.RLock()
+	defer lb.mutex.RUnlock()
+
+	backends := make([]config.BackendConfig, 0, len(lb.servers))
+	for _, server := range lb.servers {
+		backends = append(backends, config.BackendConfig{
+			URL:         server.URL.String(),
+			Weight:      server.Weight,
+			HealthCheck: server.HealthCheck,
+		})
+	}
+	return backends
+}
+
+// AddBackend добавляет бэкенд в пул. Бэкенд определяется адресом host:port,
+// поэтому два бэкенда с одинаковым адресом в пуле быть не могут
+func (lb *LoadBalancer) AddBackend(backendCfg config.BackendConfig) (*Server, error) {
+	parsed, err := url.Parse(backendCfg.URL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("неверный формат URL %s", backendCfg.URL)
+	}
+	if backendCfg.Weight < 0 {
+		return nil, fmt.Errorf("отрицательный вес для бэкенда %s: %d", backendCfg.URL, backendCfg.Weight)
+	}
+
+	lb.mutex.Lock()
+	if lb.findServer(parsed.Host) != nil {
+		lb.mutex.Unlock()
+		return nil, ErrBackendExists
+	}
+
+	server, err := lb.newServer(backendCfg, lb.opts.cfg.CircuitBreaker)
+	if err != nil {
+		lb.mutex.Unlock()
+		return nil, err
+	}
+
+	// Новый список, чтобы не менять срез, который могут читать обработчики изменений
+	servers := make([]*Server, 0, len(lb.servers)+1)
+	lb.servers = append(append(servers, lb.servers...), server)
+	lb.notify()
+	store, record := lb.store, backendRecord(server)
+	lb.mutex.Unlock()
+
+	lb.logger.Infof("Сервер %s добавлен в пул", server.URL.Host)
+	lb.save(store, record)
+	return server, nil
+}
+
+// RemoveBackend удаляет бэкенд из пула. Новые запросы на него не направляются,
+// а текущие завершаются в фоне
+func (lb *LoadBalancer) RemoveBackend(host string) error {
+	lb.mutex.Lock()
+	server := lb.findServer(host)
+	if server == nil {
+		lb.mutex.Unlock()
+		return ErrBackendNotFound
+	}
+
+	servers := make([]*Server, 0, len(lb.servers)-1)
+	for _, s := range lb.servers {
+		if s != server {
+			servers = append(servers, s)
+		}
+	}
+	lb.servers = servers
+	lb.notify()
+	store := lb.store
+	lb.mutex.Unlock()
+
+	lb.logger.Infof("Сервер %s удален из пула", server.URL.Host)
+	go lb.drain(server)
+
+	if store != nil {
+		if err := store.DeleteBackend(server.URL.String()); err != nil {
+			lb.logger.Errorf("Не удалось удалить бэкенд %s из хранилища: %v", server.URL.Host, err)
+		}
+	}
+	return nil
+}
+
+// DrainBackend прекращает направлять на бэкенд новые запросы, оставляя его в пуле
+func (lb *LoadBalancer) DrainBackend(host string) error {
+	return lb.updateBackend(host, func(server *Server) {
+		server.setState(BackendDraining)
+		go lb.drain(server)
+	})
+}
+
+// SetBackendEnabled включает или выключает направление запросов на бэкенд
+func (lb *LoadBalancer) SetBackendEnabled(host string, enabled bool) error {
+	return lb.updateBackend(host, func(server *Server) {
+		if enabled {
+			server.setState(BackendActive)
+			lb.logger.Infof("Сервер %s включен", server.URL.Host)
+		} else {
+			server.setState(BackendDisabled)
+			lb.logger.Infof("Сервер %s выключен", server.URL.Host)
+		}
+	})
+}
+
+// SetBackendWeight меняет вес бэкенда
+func (lb *LoadBalancer) SetBackendWeight(host string, weight int) error {
+	if weight <= 0 {
+		return fmt.Errorf("вес бэкенда должен быть положительным: %d", weight)
+	}
+
+	return lb.updateBackend(host, func(server *Server) {
+		server.Weight = weight
+		lb.logger.Infof("Вес сервера %s изменен на %d", server.URL.Host, weight)
+	})
+}
+
+// updateBackend изменяет сервер под мьютексом и сохраняет результат в хранилище
+func (lb *LoadBalancer) updateBackend(host string, update func(server *Server)) error {
+	lb.mutex.Lock()
+	server := lb.findServer(host)
+	if server == nil {
+		lb.mutex.Unlock()
+		return ErrBackendNotFound
+	}
+
+	update(server)
+	store, record := lb.store, backendRecord(server)
+	lb.mutex.Unlock()
+
+	lb.save(store, record)
+	return nil
+}
+
+// findServer ищет сервер по адресу host:port; вызывается под мьютексом
+func (lb *LoadBalancer) findServer(host string) *Server {
+	for _, server := range lb.servers {
+		if server.URL.Host == host {
+			return server
+		}
+	}
+	return nil
+}
+
+// backendRecord возвращает запись сервера для хранилища; вызывается под мьютексом
+func backendRecord(server *Server) storage.Backend {
+	return storage.Backend{
+		URL:     server.URL.String(),
+		Weight:  server.Weight,
+		Enabled: server.State() == BackendActive,
+	}
+}
+
+// save сохраняет бэкенд в хранилище вне блокировки балансировщика, чтобы
+// обращение к базе не задерживало выбор сервера. Ошибка хранилища не отменяет изменение в памяти
+func (lb *LoadBalancer) save(store storage.Storage, record storage.Backend) {
+	if store == nil {
+		return
+	}
+
+	if err := store.SaveBackend(record); err != nil {
+		lb.logger.Errorf("Не удалось сохранить бэкенд %s в хранилище: %v", record.URL, err)
+	}
+}
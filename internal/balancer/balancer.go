@@ -1,129 +1,486 @@
 package balancer
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"load-balancer/internal/accesslog"
+	"load-balancer/internal/config"
 	"load-balancer/internal/logger"
+	"load-balancer/pkg/requestid"
+	"load-balancer/pkg/storage"
 )
 
+// latencyDecayTime время затухания EWMA задержки (как в Finagle/Linkerd)
+const latencyDecayTime = 10 * time.Second
+
 // Server представляет бэкенд-сервер
 type Server struct {
 	URL               *url.URL
 	ReverseProxy      *httputil.ReverseProxy
-	ActiveConnections int
-	Healthy           bool
-	mutex             sync.RWMutex
+	Weight            int                             // Вес сервера для взвешенных алгоритмов
+	HealthCheck       config.BackendHealthCheckConfig // Переопределения проверки здоровья
+	activeConnections atomic.Int64                    // Количество запросов в обработке
+	healthy           atomic.Bool
+	state             atomic.Int32                   // Административное состояние, см. BackendState
+	ejected           atomic.Bool                    // Исключен пассивной проверкой здоровья
+	outlier           outlierStats                   // Статистика живого трафика для outlier detection
+	breaker           atomic.Pointer[circuitBreaker] // nil, если circuit breaker выключен
+	currentWeight     int                            // Текущий вес для smooth weighted round robin
+
+	latencyEWMA    float64   // Peak EWMA задержки ответа в наносекундах
+	latencySampled bool      // Есть ли хотя бы одно измерение задержки
+	lastLatencyAt  time.Time // Время последнего измерения
+
+	mutex sync.RWMutex
 }
 
 // LoadBalancer содержит пул серверов и стратегию распределения
 type LoadBalancer struct {
 	servers   []*Server
 	algorithm BalancingAlgorithm
+	opts      *options
+	store     storage.Storage           // nil, если пул бэкендов не сохраняется
+	listeners []func(servers []*Server) // Получают новый список серверов при его изменении
+	draining  atomic.Bool               // Балансировщик завершает работу
+	metrics   Metrics
 	logger    *logger.Logger
 	mutex     sync.RWMutex
 }
 
+// options настройки обработки запросов; при перезагрузке конфигурации заменяются целиком,
+// а запрос до конца использует те, с которыми начал обрабатываться
+type options struct {
+	cfg      config.BalancerConfig
+	sticky   *stickySessions  // nil, если sticky-сессии выключены
+	outliers *outlierDetector // nil, если пассивная проверка здоровья выключена
+	budget   *retryBudget     // nil, если повторы выключены
+}
+
 // BalancingAlgorithm определяет стратегию выбора сервера
 type BalancingAlgorithm interface {
-	NextServer(servers []*Server) *Server
+	NextServer(servers []*Server, r *http.Request) *Server
+}
+
+// currentOptions возвращает текущие настройки обработки запросов
+func (lb *LoadBalancer) currentOptions() *options {
+	lb.mutex.RLock()
+	defer lb.mutex.RUnlock()
+	return lb.opts
 }
 
-// getNextServer возвращает следующий доступный сервер
-func (lb *LoadBalancer) getNextServer() *Server {
+// getNextServer возвращает следующий доступный сервер для запроса
+func (lb *LoadBalancer) getNextServer(r *http.Request) *Server {
 	lb.mutex.RLock()
 	defer lb.mutex.RUnlock()
-	return lb.algorithm.NextServer(lb.servers)
+	return lb.algorithm.NextServer(lb.servers, r)
+}
+
+// selectServer выбирает сервер для запроса с учетом sticky-сессии
+func (lb *LoadBalancer) selectServer(w http.ResponseWriter, r *http.Request, opts *options) *Server {
+	if opts.sticky == nil {
+		return lb.getNextServer(r)
+	}
+
+	lb.mutex.RLock()
+	server := opts.sticky.lookup(r, lb.servers)
+	lb.mutex.RUnlock()
+
+	if server != nil {
+		return server
+	}
+
+	// Привязанный сервер недоступен или cookie нет - выбираем заново и выдаем новую cookie
+	server = lb.getNextServer(r)
+	if server != nil {
+		opts.sticky.setCookie(w, r, server)
+	}
+	return server
 }
 
 // ServeHTTP обрабатывает HTTP-запросы
 func (lb *LoadBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Выбираем сервер используя текущий алгоритм
-	server := lb.getNextServer()
+	opts := lb.currentOptions()
+	state := &attempt{tried: make(map[*Server]bool), budget: opts.budget}
+	maxRetries := 0
+	retryOnStatus := false
+	var body []byte
+
+	if opts.budget != nil {
+		opts.budget.recordRequest()
+
+		buffered, replayable, err := bufferBody(r, opts.cfg.Retry.MaxBodyBytes)
+		if err != nil {
+			sendErrorResponse(w, r, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		if replayable {
+			maxRetries = opts.cfg.Retry.MaxRetries
+			body = buffered
+			retryOnStatus = isIdempotent(r, opts.cfg.Retry.IdempotencyHeader)
+		}
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), attemptKey{}, state))
+
+	for try := 0; ; try++ {
+		// Выбираем сервер используя текущий алгоритм, пропуская уже опробованные
+		span := startSelectSpan(r, opts, try)
+		server := lb.acquireServer(w, r, opts, state)
+		endSelectSpan(span, server)
+
+		if server == nil {
+			if state.failed {
+				// Повторить негде: клиент получает последний ответ бэкенда, а
+				// синтетический 502 - только после ошибки соединения
+				if state.response != nil {
+					state.response.write(w, r)
+					return
+				}
+				sendErrorResponse(w, r, http.StatusBadGateway, "Bad gateway")
+				return
+			}
+			lb.logger.Warnw("Нет доступных серверов", "path", r.URL.Path, "request_id", requestid.FromContext(r.Context()))
+			sendErrorResponse(w, r, http.StatusServiceUnavailable, "No available backends")
+			return
+		}
+
+		state.tried[server] = true
+		state.canRetry = try < maxRetries
+		state.retryOnStatus = state.canRetry && retryOnStatus
+		state.failed = false
+		state.err = nil
+		state.statusCode = 0
+		state.proxyErr = nil
+		state.response = nil
+
+		if body != nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+		}
 
-	if server == nil {
-		http.Error(w, "Все серверы недоступны", http.StatusServiceUnavailable)
+		lb.forward(w, r, server, opts, state, try)
+
+		if !state.failed {
+			return
+		}
+
+		lb.metrics.IncRetry(server.URL.Host)
+		lb.logger.Warnw("Повтор запроса на другом сервере", "path", r.URL.Path, "backend", server.URL.Host,
+			"request_id", requestid.FromContext(r.Context()), "error", state.err)
+	}
+}
+
+// acquireServer выбирает сервер и резервирует запрос в его circuit breaker.
+// Если пробные запросы полуразомкнутого выключателя уже разобраны, выбирается другой сервер
+func (lb *LoadBalancer) acquireServer(w http.ResponseWriter, r *http.Request, opts *options, state *attempt) *Server {
+	for {
+		server := lb.selectServer(w, r, opts)
+		if server == nil {
+			return nil
+		}
+
+		breaker := server.breaker.Load()
+		if breaker == nil || breaker.acquire() {
+			state.breaker = breaker
+			return server
+		}
+		state.tried[server] = true
+	}
+}
+
+// forward выполняет одну попытку проксирования и учитывает ее результат. Если
+// ReverseProxy прервал обработчик паникой (ответ оборвался на середине тела),
+// результат не учитывается, но зарезервированный в circuit breaker запрос
+// возвращается, иначе пробные запросы полуразомкнутого выключателя утекали бы
+func (lb *LoadBalancer) forward(w http.ResponseWriter, r *http.Request, server *Server, opts *options, state *attempt, try int) {
+	recorded := false
+	defer func() {
+		if !recorded && state.breaker != nil {
+			state.breaker.release()
+		}
+	}()
+
+	latency := lb.proxy(w, r, server, try)
+	lb.recordOutcome(server, opts, state)
+	recorded = true
+	lb.observe(server, r, state, latency)
+}
+
+// recordOutcome учитывает результат попытки в пассивной проверке здоровья и circuit breaker
+func (lb *LoadBalancer) recordOutcome(server *Server, opts *options, state *attempt) {
+	// Отмена запроса клиентом не является проблемой бэкенда
+	if errors.Is(state.proxyErr, context.Canceled) {
+		if state.breaker != nil {
+			state.breaker.release()
+		}
 		return
 	}
 
+	connErr := state.proxyErr != nil
+	if opts.outliers != nil {
+		opts.outliers.record(server, state.statusCode, connErr)
+	}
+	if state.breaker != nil {
+		state.breaker.record(connErr || state.statusCode >= 500)
+	}
+}
+
+// observe передает результат попытки в метрики
+func (lb *LoadBalancer) observe(server *Server, r *http.Request, state *attempt, latency time.Duration) {
+	if entry := accesslog.FromContext(r.Context()); entry != nil {
+		entry.RecordAttempt(server.URL.Host, latency)
+	}
+
+	if state.proxyErr != nil {
+		lb.metrics.IncProxyError(server.URL.Host, proxyErrorReason(state.proxyErr))
+		return
+	}
+	lb.metrics.ObserveUpstream(server.URL.Host, r.Method, state.statusCode, latency)
+}
+
+// proxy перенаправляет запрос на сервер с учетом счетчиков и задержки. ReverseProxy
+// прерывает обработчик паникой http.ErrAbortHandler, если ответ оборвался на середине
+// тела, поэтому счетчик, спан и задержка учитываются в defer
+func (lb *LoadBalancer) proxy(w http.ResponseWriter, r *http.Request, server *Server, try int) (latency time.Duration) {
 	// Увеличиваем счетчик активных соединений
-	server.mutex.Lock()
-	server.ActiveConnections++
-	server.mutex.Unlock()
+	server.activeConnections.Add(1)
+	defer server.activeConnections.Add(-1)
 
 	// Логируем запрос
-	lb.logger.Infof("Запрос %s перенаправлен на %s", r.URL.Path, server.URL.Host)
+	lb.logger.Debugw("Запрос перенаправлен", "path", r.URL.Path, "backend", server.URL.Host,
+		"request_id", requestid.FromContext(r.Context()))
 
 	// Перенаправляем запрос на выбранный сервер
-	server.ReverseProxy.ServeHTTP(w, r)
+	ctx, span := startUpstreamSpan(r, server, try)
+	start := time.Now()
+	defer func() {
+		latency = time.Since(start)
+		endUpstreamSpan(span, attemptFromContext(r.Context()))
+		server.ObserveLatency(latency)
+	}()
 
-	// Уменьшаем счетчик активных соединений
-	server.mutex.Lock()
-	server.ActiveConnections--
-	server.mutex.Unlock()
+	server.ReverseProxy.ServeHTTP(w, r.WithContext(ctx))
+	return latency
+}
+
+// IsAvailable проверяет, можно ли направлять запросы на сервер: он не выключен администратором,
+// прошел активную проверку здоровья, не исключен по живому трафику и его circuit breaker не разомкнут
+func (s *Server) IsAvailable() bool {
+	if s.State() != BackendActive || !s.IsHealthy() || s.IsEjected() {
+		return false
+	}
+	breaker := s.breaker.Load()
+	return breaker == nil || breaker.available()
 }
 
-// IsHealthy проверяет, доступен ли сервер
+// IsHealthy проверяет, доступен ли сервер по результатам активной проверки
 func (s *Server) IsHealthy() bool {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-	return s.Healthy
+	return s.healthy.Load()
 }
 
 // SetHealth устанавливает статус здоровья сервера
 func (s *Server) SetHealth(healthy bool) {
+	s.healthy.Store(healthy)
+}
+
+// ObserveLatency учитывает задержку ответа в peak EWMA: всплески применяются сразу,
+// а снижение задержки учитывается постепенно с затуханием по времени
+func (s *Server) ObserveLatency(latency time.Duration) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	s.Healthy = healthy
+
+	now := time.Now()
+	sample := float64(latency)
+
+	switch {
+	case !s.latencySampled:
+		s.latencyEWMA = sample
+		s.latencySampled = true
+	case sample > s.latencyEWMA:
+		s.latencyEWMA = sample
+	default:
+		elapsed := now.Sub(s.lastLatencyAt)
+		w := math.Exp(-float64(elapsed) / float64(latencyDecayTime))
+		s.latencyEWMA = s.latencyEWMA*w + sample*(1-w)
+	}
+
+	s.lastLatencyAt = now
+}
+
+// Latency возвращает текущую оценку задержки сервера и признак наличия измерений
+func (s *Server) Latency() (time.Duration, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return time.Duration(s.latencyEWMA), s.latencySampled
+}
+
+// ActiveConnections возвращает количество запросов к серверу в обработке
+func (s *Server) ActiveConnections() int64 {
+	return s.activeConnections.Load()
 }
 
 // NewLoadBalancer создает новый балансировщик нагрузки
-func NewLoadBalancer(backends []string, algorithmName string, logger *logger.Logger) (*LoadBalancer, error) {
+func NewLoadBalancer(backends []config.BackendConfig, balancerCfg config.BalancerConfig, logger *logger.Logger) (*LoadBalancer, error) {
+	lb := &LoadBalancer{
+		logger:  logger,
+		metrics: noopMetrics{},
+	}
+
+	algorithm, err := newAlgorithm(balancerCfg)
+	if err != nil {
+		return nil, err
+	}
+
 	servers := make([]*Server, 0, len(backends))
 
-	for _, backend := range backends {
-		url, err := url.Parse(backend)
+	for _, backendCfg := range backends {
+		server, err := lb.newServer(backendCfg, balancerCfg.CircuitBreaker)
 		if err != nil {
-			return nil, fmt.Errorf("неверный формат URL %s: %v", backend, err)
+			return nil, err
 		}
 
-		proxy := httputil.NewSingleHostReverseProxy(url)
+		servers = append(servers, server)
+	}
+
+	lb.servers = servers
+	lb.algorithm = algorithm
+	lb.opts = lb.newOptions(balancerCfg)
+
+	return lb, nil
+}
 
-		// Настройка обработки ошибок при проксировании
-		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-			logger.Errorf("Ошибка проксирования запроса к %s: %v", backend, err)
-			http.Error(w, "Ошибка при проксировании запроса", http.StatusBadGateway)
+// newAlgorithm создает алгоритм балансировки по настройкам
+func newAlgorithm(balancerCfg config.BalancerConfig) (BalancingAlgorithm, error) {
+	switch balancerCfg.Algorithm {
+	case "round-robin":
+		return NewRoundRobin(), nil
+	case "weighted-round-robin":
+		return NewWeightedRoundRobin(), nil
+	case "least-connections":
+		return NewLeastConnections(), nil
+	case "p2c":
+		return NewPowerOfTwoChoices(), nil
+	case "random":
+		return NewRandom(), nil
+	case "least-latency":
+		return NewLeastLatency(), nil
+	case "consistent-hash":
+		keyFunc, err := newHashKeyFunc(balancerCfg.HashKey)
+		if err != nil {
+			return nil, err
 		}
+		return NewConsistentHash(keyFunc), nil
+	default:
+		return nil, fmt.Errorf("неизвестный алгоритм балансировки: %s", balancerCfg.Algorithm)
+	}
+}
+
+// newOptions создает настройки обработки запросов
+func (lb *LoadBalancer) newOptions(balancerCfg config.BalancerConfig) *options {
+	opts := &options{cfg: balancerCfg}
 
-		server := &Server{
-			URL:               url,
-			ReverseProxy:      proxy,
-			ActiveConnections: 0,
-			Healthy:           true,
+	if balancerCfg.StickySession.Enabled {
+		opts.sticky = newStickySessions(balancerCfg.StickySession)
+	}
+
+	if balancerCfg.OutlierDetection.Enabled {
+		opts.outliers = newOutlierDetector(balancerCfg.OutlierDetection, lb, lb.logger)
+	}
+
+	if balancerCfg.Retry.MaxRetries > 0 {
+		opts.budget = newRetryBudget(balancerCfg.Retry)
+	}
+
+	return opts
+}
+
+// newServer создает сервер с обратным прокси для бэкенда
+func (lb *LoadBalancer) newServer(backendCfg config.BackendConfig, breakerCfg config.CircuitBreakerConfig) (*Server, error) {
+	backend := backendCfg.URL
+	url, err := url.Parse(backend)
+	if err != nil {
+		return nil, fmt.Errorf("неверный формат URL %s: %v", backend, err)
+	}
+
+	weight := backendCfg.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(url)
+	director := proxy.Director
+	proxy.Director = func(outreq *http.Request) {
+		director(outreq)
+		injectTraceContext(outreq)
+	}
+
+	server := &Server{
+		URL:          url,
+		ReverseProxy: proxy,
+		Weight:       weight,
+		HealthCheck:  backendCfg.HealthCheck,
+	}
+	server.SetHealth(true)
+	server.setCircuitBreaker(breakerCfg, lb.logger)
+
+	// Запоминаем код ответа бэкенда для пассивной проверки здоровья и circuit breaker
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		// Идентификатор уже выставлен в ответе клиенту; копия от бэкенда его бы продублировала
+		if requestid.FromContext(resp.Request.Context()) != "" {
+			resp.Header.Del(requestid.Header)
 		}
 
-		servers = append(servers, server)
+		state := attemptFromContext(resp.Request.Context())
+		if state != nil {
+			state.statusCode = resp.StatusCode
+		}
+
+		// Ответ 502/503/504 на идемпотентный запрос отбрасываем и повторяем на другом сервере
+		if state != nil && state.retryOnStatus && isRetryableStatus(resp.StatusCode) && state.budget.tryWithdraw() {
+			state.response = retainResponse(resp)
+			return fmt.Errorf("%w: %d", errRetryableStatus, resp.StatusCode)
+		}
+		return nil
 	}
 
-	// Выбираем алгоритм балансировки
-	var algorithm BalancingAlgorithm
-	switch algorithmName {
-	case "round-robin":
-		algorithm = NewRoundRobin()
-	case "least-connections":
-		algorithm = NewLeastConnections()
-	default:
-		return nil, fmt.Errorf("неизвестный алгоритм балансировки: %s", algorithmName)
+	// Настройка обработки ошибок при проксировании
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		state := attemptFromContext(r.Context())
+
+		if errors.Is(err, errRetryableStatus) {
+			state.failed = true
+			state.err = err
+			return
+		}
+
+		if state != nil {
+			state.proxyErr = err
+		}
+
+		// Соединение не установлено - запрос не дошел до бэкенда, повторяем для любого метода
+		if state != nil && state.canRetry && isDialError(err) && state.budget.tryWithdraw() {
+			state.failed = true
+			state.err = err
+			return
+		}
+
+		lb.logger.Errorw("Ошибка проксирования запроса", "path", r.URL.Path, "backend", url.Host,
+			"request_id", requestid.FromContext(r.Context()), "error", err)
+		sendErrorResponse(w, r, http.StatusBadGateway, "Bad gateway")
 	}
 
-	return &LoadBalancer{
-		servers:   servers,
-		algorithm: algorithm,
-		logger:    logger,
-	}, nil
+	return server, nil
 }
 
 // Servers возвращает срез серверов балансировщика
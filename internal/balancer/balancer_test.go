@@ -0,0 +1,494 @@
+package balancer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"load-balancer/internal/config"
+	"load-balancer/internal/logger"
+)
+
+// newTestBackend запускает бэкенд, отвечающий своим именем
+func newTestBackend(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name)
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// newTestLoadBalancer создает балансировщик для тестов с отключенным логированием
+func newTestLoadBalancer(t *testing.T, balancerCfg config.BalancerConfig, backends ...*httptest.Server) *LoadBalancer {
+	t.Helper()
+
+	backendCfgs := make([]config.BackendConfig, 0, len(backends))
+	for _, backend := range backends {
+		backendCfgs = append(backendCfgs, config.BackendConfig{URL: backend.URL, Weight: 1})
+	}
+
+	lb, err := NewLoadBalancer(backendCfgs, balancerCfg, logger.NewLoggerWithLevel(logger.FatalLevel, io.Discard))
+	require.NoError(t, err)
+	return lb
+}
+
+// doRequest выполняет запрос через балансировщик
+func doRequest(lb http.Handler, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	lb.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestStickySessions(t *testing.T) {
+	backends := map[string]*httptest.Server{
+		"one": newTestBackend(t, "one"),
+		"two": newTestBackend(t, "two"),
+	}
+	lb := newTestLoadBalancer(t, config.BalancerConfig{
+		Algorithm: "round-robin",
+		StickySession: config.StickySessionConfig{
+			Enabled:    true,
+			CookieName: "lb_backend",
+			TTL:        time.Hour,
+			Secret:     "secret",
+		},
+	}, backends["one"], backends["two"])
+
+	first := doRequest(lb)
+	require.Equal(t, http.StatusOK, first.Code)
+	cookies := first.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	// Последующие запросы с cookie попадают на тот же бэкенд без выдачи новой cookie
+	for i := 0; i < 5; i++ {
+		rec := doRequest(lb, cookies[0])
+		assert.Equal(t, first.Body.String(), rec.Body.String())
+		assert.Empty(t, rec.Result().Cookies())
+	}
+
+	// Подделанная cookie игнорируется
+	forged := *cookies[0]
+	forged.Value = "x" + forged.Value
+	assert.NotEmpty(t, doRequest(lb, &forged).Result().Cookies())
+
+	// При недоступности бэкенда выбирается другой и cookie перевыпускается
+	for _, server := range lb.Servers() {
+		if server.URL.String() == backends[first.Body.String()].URL {
+			server.SetHealth(false)
+		}
+	}
+
+	rec := doRequest(lb, cookies[0])
+	assert.NotEqual(t, first.Body.String(), rec.Body.String())
+	assert.Len(t, rec.Result().Cookies(), 1)
+}
+
+func TestOutlierDetectionEjectsFailingServer(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(failing.Close)
+
+	lb := newTestLoadBalancer(t, config.BalancerConfig{
+		Algorithm: "round-robin",
+		OutlierDetection: config.OutlierDetectionConfig{
+			Enabled:            true,
+			Consecutive5xx:     3,
+			ConsecutiveErrors:  3,
+			Interval:           time.Minute,
+			BaseEjectionTime:   50 * time.Millisecond,
+			MaxEjectionTime:    time.Second,
+			MaxEjectionPercent: 50,
+		},
+	}, failing, newTestBackend(t, "ok"))
+
+	bad := lb.Servers()[0]
+	for i := 0; i < 6; i++ {
+		doRequest(lb)
+	}
+	require.True(t, bad.IsEjected())
+	assert.False(t, bad.IsAvailable())
+
+	// Пока сервер исключен, все запросы идут на исправный бэкенд
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "ok", doRequest(lb).Body.String())
+	}
+
+	// Второй сервер исключить нельзя: превышена максимальная доля
+	lb.opts.outliers.eject(lb.Servers()[1], "тест")
+	assert.False(t, lb.Servers()[1].IsEjected())
+
+	// Возврат в пул только после истечения времени исключения
+	assert.False(t, bad.readmit())
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, bad.readmit())
+	assert.True(t, bad.IsAvailable())
+}
+
+func TestOutlierDetectionConcurrentEjectRespectsMaxPercent(t *testing.T) {
+	backends := make([]*httptest.Server, 10)
+	for i := range backends {
+		backends[i] = newTestBackend(t, "ok")
+	}
+	lb := newTestLoadBalancer(t, config.BalancerConfig{
+		Algorithm: "round-robin",
+		OutlierDetection: config.OutlierDetectionConfig{
+			Enabled:            true,
+			Consecutive5xx:     3,
+			ConsecutiveErrors:  3,
+			Interval:           time.Minute,
+			BaseEjectionTime:   time.Minute,
+			MaxEjectionTime:    time.Minute,
+			MaxEjectionPercent: 30,
+		},
+	}, backends...)
+
+	// Все серверы одновременно пытаются попасть в исключенные; гонка проявляется
+	// не с первой попытки, поэтому повторяем, каждый раз возвращая серверы в пул
+	for round := 0; round < 100; round++ {
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for _, server := range lb.Servers() {
+			wg.Add(1)
+			go func(server *Server) {
+				defer wg.Done()
+				<-start
+				lb.opts.outliers.eject(server, "тест")
+			}(server)
+		}
+		close(start)
+		wg.Wait()
+
+		ejected := 0
+		for _, server := range lb.Servers() {
+			if server.IsEjected() {
+				ejected++
+			}
+			server.ejected.Store(false)
+		}
+		require.Equal(t, 3, ejected, "раунд %d", round)
+	}
+}
+
+func TestRetryOnDialErrorAndRetryableStatus(t *testing.T) {
+	// Адрес, на котором никто не слушает
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(unavailable.Close)
+
+	var received []string
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(ok.Close)
+
+	lb := newTestLoadBalancer(t, config.BalancerConfig{
+		Algorithm: "round-robin",
+		Retry: config.RetryConfig{
+			MaxRetries:          2,
+			IdempotencyHeader:   "Idempotency-Key",
+			MaxBodyBytes:        1024,
+			BudgetRatio:         0.2,
+			MinRetriesPerSecond: 10,
+		},
+	}, dead, unavailable, ok)
+
+	// GET повторяется и после ошибки соединения, и после 503
+	for i := 0; i < 3; i++ {
+		rec := doRequest(lb)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "ok", rec.Body.String())
+	}
+
+	// POST после 503 не повторяется, а тело передается при повторе после ошибки соединения.
+	// Round robin: dead -> unavailable (503), ok, dead -> unavailable (503)
+	statuses := map[int]int{}
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+		rec := httptest.NewRecorder()
+		lb.ServeHTTP(rec, req)
+		statuses[rec.Code]++
+	}
+	assert.Equal(t, map[int]int{http.StatusOK: 1, http.StatusServiceUnavailable: 2}, statuses)
+
+	// С заголовком идемпотентности POST повторяется и после 503
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+		req.Header.Set("Idempotency-Key", "key")
+		rec := httptest.NewRecorder()
+		lb.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	for _, body := range received[3:] {
+		assert.Equal(t, "payload", body)
+	}
+}
+
+func TestRetriesExhaustedOnRetryableStatus(t *testing.T) {
+	newUnavailable := func(name string) *httptest.Server {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, name)
+		}))
+		t.Cleanup(backend.Close)
+		return backend
+	}
+
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	retry := config.RetryConfig{MaxRetries: 3, MaxBodyBytes: 1024, BudgetRatio: 1, MinRetriesPerSecond: 10}
+	lb := newTestLoadBalancer(t, config.BalancerConfig{Algorithm: "round-robin", Retry: retry},
+		newUnavailable("first"), newUnavailable("second"))
+
+	// Оба бэкенда ответили 503: клиент получает ответ последнего, а не 502
+	rec := doRequest(lb)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "120", rec.Header().Get("Retry-After"))
+	assert.Equal(t, "second", rec.Body.String())
+
+	// Последняя попытка не дошла до бэкенда: синтетический 502
+	lb = newTestLoadBalancer(t, config.BalancerConfig{Algorithm: "round-robin", Retry: retry},
+		newUnavailable("first"), dead)
+	rec = doRequest(lb)
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := newRetryBudget(config.RetryConfig{BudgetRatio: 0.5, MinRetriesPerSecond: 0})
+
+	for i := 0; i < 4; i++ {
+		budget.recordRequest()
+	}
+	assert.True(t, budget.tryWithdraw())
+	assert.True(t, budget.tryWithdraw())
+	assert.False(t, budget.tryWithdraw(), "повторов не может быть больше половины запросов")
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	cb := newCircuitBreaker(config.CircuitBreakerConfig{
+		Enabled:          true,
+		FailureRatio:     0.5,
+		MinRequests:      4,
+		Window:           time.Minute,
+		OpenDuration:     50 * time.Millisecond,
+		HalfOpenRequests: 2,
+	}, "backend", logger.NewLoggerWithLevel(logger.FatalLevel, io.Discard))
+
+	// Доля ошибок оценивается только после минимального числа запросов
+	cb.record(true)
+	cb.record(true)
+	cb.record(false)
+	assert.Equal(t, BreakerClosed, cb.State())
+	cb.record(true)
+	assert.Equal(t, BreakerOpen, cb.State())
+	assert.False(t, cb.available())
+	assert.False(t, cb.acquire())
+
+	// После OpenDuration пропускается ограниченное число пробных запросов
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, BreakerHalfOpen, cb.State())
+	assert.True(t, cb.acquire())
+	assert.True(t, cb.acquire())
+	assert.False(t, cb.available())
+	assert.False(t, cb.acquire())
+
+	// Ошибка пробного запроса снова размыкает выключатель
+	cb.record(true)
+	assert.Equal(t, BreakerOpen, cb.State())
+
+	time.Sleep(60 * time.Millisecond)
+	require.True(t, cb.acquire())
+	require.True(t, cb.acquire())
+	cb.record(false)
+	cb.record(false)
+	assert.Equal(t, BreakerClosed, cb.State())
+}
+
+func TestCircuitBreakerRoutesAroundOpenServer(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+
+	lb := newTestLoadBalancer(t, config.BalancerConfig{
+		Algorithm: "round-robin",
+		CircuitBreaker: config.CircuitBreakerConfig{
+			Enabled:          true,
+			FailureRatio:     0.5,
+			MinRequests:      2,
+			Window:           time.Minute,
+			OpenDuration:     time.Minute,
+			HalfOpenRequests: 1,
+		},
+	}, failing, newTestBackend(t, "ok"))
+
+	for i := 0; i < 4; i++ {
+		doRequest(lb)
+	}
+	require.Equal(t, BreakerOpen, lb.Servers()[0].BreakerState())
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "ok", doRequest(lb).Body.String())
+	}
+}
+
+func TestAbortedResponseReleasesHalfOpenTrial(t *testing.T) {
+	lb := newTestLoadBalancer(t, config.BalancerConfig{
+		Algorithm: "round-robin",
+		CircuitBreaker: config.CircuitBreakerConfig{
+			Enabled:          true,
+			FailureRatio:     0.5,
+			MinRequests:      2,
+			Window:           time.Minute,
+			OpenDuration:     time.Minute,
+			HalfOpenRequests: 1,
+		},
+	}, newAbortingBackend(t))
+
+	breaker := lb.Servers()[0].breaker.Load()
+	breaker.mutex.Lock()
+	breaker.transition(BreakerHalfOpen, time.Now())
+	breaker.mutex.Unlock()
+
+	// Оборванный ответ не занимает единственный пробный запрос навсегда
+	for i := 0; i < 3; i++ {
+		doAbortedRequest(t, lb)
+		require.Eventually(t, breaker.available, time.Second, 10*time.Millisecond)
+	}
+	assert.Equal(t, BreakerHalfOpen, breaker.State())
+}
+
+func TestReloadKeepsExistingServers(t *testing.T) {
+	one := newTestBackend(t, "one")
+	two := newTestBackend(t, "two")
+	three := newTestBackend(t, "three")
+
+	lb := newTestLoadBalancer(t, config.BalancerConfig{Algorithm: "round-robin"}, one, two)
+	kept := lb.Servers()[1]
+	kept.SetHealth(false)
+
+	err := lb.Reload([]config.BackendConfig{
+		{URL: two.URL, Weight: 3},
+		{URL: three.URL, Weight: 1},
+	}, config.BalancerConfig{Algorithm: "weighted-round-robin"})
+	require.NoError(t, err)
+
+	servers := lb.Servers()
+	require.Len(t, servers, 2)
+	assert.Same(t, kept, servers[0])
+	assert.Equal(t, 3, servers[0].Weight)
+	assert.False(t, servers[0].IsHealthy())
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "three", doRequest(lb).Body.String())
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	one := newTestBackend(t, "one")
+	lb := newTestLoadBalancer(t, config.BalancerConfig{Algorithm: "round-robin"}, one)
+	before := lb.Servers()
+
+	err := lb.Reload([]config.BackendConfig{{URL: newTestBackend(t, "two").URL}}, config.BalancerConfig{Algorithm: "unknown"})
+	require.Error(t, err)
+	assert.Equal(t, before, lb.Servers())
+	assert.Equal(t, "one", doRequest(lb).Body.String())
+}
+
+// newAbortingBackend запускает бэкенд, обрывающий соединение посреди тела ответа
+func newAbortingBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		io.WriteString(w, "partial")
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// doAbortedRequest выполняет запрос через балансировщик за настоящим HTTP-сервером:
+// только в нем ReverseProxy прерывает обработчик паникой http.ErrAbortHandler
+func doAbortedRequest(t *testing.T, lb http.Handler) {
+	t.Helper()
+	front := httptest.NewServer(lb)
+	t.Cleanup(front.Close)
+
+	// Обрыв виден клиенту либо сразу, либо при чтении тела
+	resp, err := http.Get(front.URL)
+	if err == nil {
+		_, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	require.Error(t, err, "ответ должен оборваться")
+}
+
+func TestAbortedResponseReleasesConnection(t *testing.T) {
+	lb := newTestLoadBalancer(t, config.BalancerConfig{Algorithm: "round-robin"}, newAbortingBackend(t))
+	server := lb.Servers()[0]
+
+	for i := 0; i < 3; i++ {
+		doAbortedRequest(t, lb)
+	}
+	require.Eventually(t, func() bool { return server.ActiveConnections() == 0 }, time.Second, 10*time.Millisecond)
+	_, sampled := server.Latency()
+	assert.True(t, sampled)
+}
+
+func TestDrainWaitsForInFlightRequests(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		io.WriteString(w, "slow")
+	}))
+	t.Cleanup(slow.Close)
+
+	lb := newTestLoadBalancer(t, config.BalancerConfig{Algorithm: "round-robin", DrainTimeout: time.Second}, slow, newTestBackend(t, "fast"))
+	server := lb.Servers()[0]
+
+	done := make(chan string)
+	go func() {
+		done <- doRequest(lb).Body.String()
+	}()
+	require.Eventually(t, func() bool { return server.ActiveConnections() == 1 }, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, lb.DrainBackend(server.URL.Host))
+	assert.Equal(t, BackendDraining, server.State())
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "fast", doRequest(lb).Body.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, lb.WaitIdle(ctx))
+
+	close(release)
+	assert.Equal(t, "slow", <-done)
+	assert.NoError(t, lb.WaitIdle(context.Background()))
+}
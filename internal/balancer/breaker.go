@@ -0,0 +1,199 @@
+package balancer
+
+import (
+	"sync"
+	"time"
+
+	"load-balancer/internal/config"
+	"load-balancer/internal/logger"
+)
+
+// BreakerState состояние автоматического выключателя
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+// String возвращает название состояния
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// circuitBreaker автоматический выключатель бэкенда: размыкается при большой доле ошибок,
+// через OpenDuration пропускает ограниченное число пробных запросов и замыкается, если они успешны
+type circuitBreaker struct {
+	cfg    config.CircuitBreakerConfig
+	host   string
+	logger *logger.Logger
+
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	trials      int // Пробных запросов выдано в полуразомкнутом состоянии
+	successes   int // Успешных пробных запросов
+	mutex       sync.Mutex
+}
+
+// newCircuitBreaker создает замкнутый выключатель для сервера
+func newCircuitBreaker(cfg config.CircuitBreakerConfig, host string, logger *logger.Logger) *circuitBreaker {
+	return &circuitBreaker{
+		cfg:         cfg,
+		host:        host,
+		logger:      logger,
+		windowStart: time.Now(),
+	}
+}
+
+// State возвращает текущее состояние выключателя
+func (cb *circuitBreaker) State() BreakerState {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.advance(time.Now())
+	return cb.state
+}
+
+// available проверяет, можно ли выбрать сервер: выключатель замкнут
+// или в полуразомкнутом состоянии остались пробные запросы
+func (cb *circuitBreaker) available() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.advance(time.Now())
+
+	switch cb.state {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		return cb.trials < cb.cfg.HalfOpenRequests
+	default:
+		return false
+	}
+}
+
+// acquire резервирует запрос к серверу; в полуразомкнутом состоянии расходует пробный запрос
+func (cb *circuitBreaker) acquire() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.advance(time.Now())
+
+	switch cb.state {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		if cb.trials < cb.cfg.HalfOpenRequests {
+			cb.trials++
+			return true
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// release возвращает зарезервированный запрос без учета результата (например, при отмене клиентом)
+func (cb *circuitBreaker) release() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state == BreakerHalfOpen && cb.trials > cb.successes {
+		cb.trials--
+	}
+}
+
+// record учитывает результат запроса к серверу
+func (cb *circuitBreaker) record(failure bool) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	now := time.Now()
+	cb.advance(now)
+
+	switch cb.state {
+	case BreakerClosed:
+		if now.Sub(cb.windowStart) > cb.cfg.Window {
+			cb.windowStart = now
+			cb.requests = 0
+			cb.failures = 0
+		}
+
+		cb.requests++
+		if failure {
+			cb.failures++
+		}
+
+		if cb.requests >= cb.cfg.MinRequests &&
+			float64(cb.failures)/float64(cb.requests) >= cb.cfg.FailureRatio {
+			cb.transition(BreakerOpen, now)
+		}
+	case BreakerHalfOpen:
+		if failure {
+			cb.transition(BreakerOpen, now)
+			return
+		}
+
+		cb.successes++
+		if cb.successes >= cb.cfg.HalfOpenRequests {
+			cb.transition(BreakerClosed, now)
+		}
+	}
+}
+
+// advance переводит разомкнутый выключатель в полуразомкнутый по истечении OpenDuration.
+// Вызывается под блокировкой
+func (cb *circuitBreaker) advance(now time.Time) {
+	if cb.state == BreakerOpen && now.Sub(cb.openedAt) >= cb.cfg.OpenDuration {
+		cb.transition(BreakerHalfOpen, now)
+	}
+}
+
+// transition меняет состояние выключателя и сбрасывает счетчики. Вызывается под блокировкой
+func (cb *circuitBreaker) transition(state BreakerState, now time.Time) {
+	from := cb.state
+	cb.state = state
+	cb.windowStart = now
+	cb.requests = 0
+	cb.failures = 0
+	cb.trials = 0
+	cb.successes = 0
+
+	if state == BreakerOpen {
+		cb.openedAt = now
+		cb.logger.Warnf("Circuit breaker сервера %s: %s -> %s", cb.host, from, state)
+		return
+	}
+	cb.logger.Infof("Circuit breaker сервера %s: %s -> %s", cb.host, from, state)
+}
+
+// BreakerState возвращает состояние выключателя сервера; без выключателя сервер всегда замкнут
+func (s *Server) BreakerState() BreakerState {
+	breaker := s.breaker.Load()
+	if breaker == nil {
+		return BreakerClosed
+	}
+	return breaker.State()
+}
+
+// setCircuitBreaker устанавливает новый выключатель сервера по настройкам или убирает его
+func (s *Server) setCircuitBreaker(cfg config.CircuitBreakerConfig, logger *logger.Logger) {
+	if !cfg.Enabled {
+		s.breaker.Store(nil)
+		return
+	}
+	s.breaker.Store(newCircuitBreaker(cfg, s.URL.Host, logger))
+}
@@ -0,0 +1,63 @@
+package balancer
+
+import (
+	"context"
+	"time"
+)
+
+// drainPollInterval период проверки числа активных запросов при выводе из работы
+const drainPollInterval = 100 * time.Millisecond
+
+// StartDraining переводит балансировщик в режим завершения работы. Запросы
+// продолжают обслуживаться, но IsDraining сообщает, что новых направлять не нужно
+func (lb *LoadBalancer) StartDraining() {
+	if lb.draining.CompareAndSwap(false, true) {
+		lb.logger.Info("Балансировщик переведен в режим завершения работы")
+	}
+}
+
+// IsDraining сообщает, завершает ли балансировщик работу
+func (lb *LoadBalancer) IsDraining() bool {
+	return lb.draining.Load()
+}
+
+// WaitIdle ждет завершения запросов, проксируемых на все серверы пула. В отличие от
+// http.Server.Shutdown учитывает и соединения, захваченные после Upgrade (например, WebSocket)
+func (lb *LoadBalancer) WaitIdle(ctx context.Context) error {
+	for _, server := range lb.Servers() {
+		if err := server.waitIdle(ctx); err != nil {
+			lb.logger.Warnf("Не дождались завершения %d запросов к серверу %s", server.ActiveConnections(), server.URL.Host)
+			return err
+		}
+	}
+	return nil
+}
+
+// drain ждет завершения активных запросов к серверу, на который больше не направляются новые
+func (lb *LoadBalancer) drain(server *Server) {
+	lb.logger.Infof("Ожидание завершения запросов к серверу %s, активных запросов: %d", server.URL.Host, server.ActiveConnections())
+
+	ctx, cancel := context.WithTimeout(context.Background(), lb.currentOptions().cfg.DrainTimeout)
+	defer cancel()
+
+	if err := server.waitIdle(ctx); err != nil {
+		lb.logger.Warnf("Сервер %s выведен из работы с %d незавершенными запросами", server.URL.Host, server.ActiveConnections())
+		return
+	}
+	lb.logger.Infof("Сервер %s выведен из работы", server.URL.Host)
+}
+
+// waitIdle ждет, пока у сервера не останется активных запросов
+func (s *Server) waitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for s.ActiveConnections() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package balancer
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"load-balancer/internal/config"
+	"load-balancer/pkg/requestid"
+)
+
+// BackendRequest структура для запроса добавления бэкенда
+type BackendRequest struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// BackendWeightRequest структура для запроса изменения веса бэкенда
+type BackendWeightRequest struct {
+	Weight int `json:"weight"`
+}
+
+// BackendResponse структура для ответа с информацией о бэкенде
+type BackendResponse struct {
+	URL               string  `json:"url"`
+	Host              string  `json:"host"` // Идентификатор бэкенда в путях API
+	Weight            int     `json:"weight"`
+	State             string  `json:"state"` // active, disabled или draining
+	Healthy           bool    `json:"healthy"`
+	Ejected           bool    `json:"ejected"`
+	CircuitBreaker    string  `json:"circuit_breaker"`
+	ActiveConnections int64   `json:"active_connections"`
+	LatencyMs         float64 `json:"latency_ms,omitempty"`
+	Message           string  `json:"message,omitempty"`
+}
+
+// ErrorResponse структура для ответа с ошибкой
+type ErrorResponse struct {
+	Code      int    `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// CircuitBreakerResponse структура для ответа с состоянием circuit breaker бэкенда
+type CircuitBreakerResponse struct {
+	Backend string `json:"backend"`
+	State   string `json:"state"`
+}
+
+// ListCircuitBreakersHandler обрабатывает запросы на получение состояния circuit breaker всех бэкендов
+func (lb *LoadBalancer) ListCircuitBreakersHandler(w http.ResponseWriter, r *http.Request) {
+	servers := lb.Servers()
+	breakers := make([]CircuitBreakerResponse, 0, len(servers))
+
+	for _, server := range servers {
+		breakers = append(breakers, CircuitBreakerResponse{
+			Backend: server.URL.String(),
+			State:   server.BreakerState().String(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(breakers)
+}
+
+// ListBackendsHandler обрабатывает запросы на получение списка бэкендов пула
+func (lb *LoadBalancer) ListBackendsHandler(w http.ResponseWriter, r *http.Request) {
+	lb.mutex.RLock()
+	backends := make([]BackendResponse, 0, len(lb.servers))
+	for _, server := range lb.servers {
+		backends = append(backends, newBackendResponse(server))
+	}
+	lb.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(backends)
+}
+
+// AddBackendHandler обрабатывает запросы на добавление бэкенда
+func (lb *LoadBalancer) AddBackendHandler(w http.ResponseWriter, r *http.Request) {
+	var req BackendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.URL == "" {
+		sendErrorResponse(w, r, http.StatusBadRequest, "url is required")
+		return
+	}
+
+	weight := req.Weight
+	if weight == 0 {
+		weight = 1
+	}
+
+	server, err := lb.AddBackend(config.BackendConfig{URL: req.URL, Weight: weight})
+	if errors.Is(err, ErrBackendExists) {
+		sendErrorResponse(w, r, http.StatusConflict, "Backend already exists")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "Invalid backend: url must be absolute and weight must not be negative")
+		return
+	}
+
+	lb.mutex.RLock()
+	response := newBackendResponse(server)
+	lb.mutex.RUnlock()
+	response.Message = "Backend added successfully"
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetBackendHandler обрабатывает запросы на получение информации о бэкенде
+func (lb *LoadBalancer) GetBackendHandler(w http.ResponseWriter, r *http.Request) {
+	lb.mutex.RLock()
+	server := lb.findServer(mux.Vars(r)["host"])
+	var response BackendResponse
+	if server != nil {
+		response = newBackendResponse(server)
+	}
+	lb.mutex.RUnlock()
+
+	if server == nil {
+		sendErrorResponse(w, r, http.StatusNotFound, "Backend not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateBackendHandler обрабатывает запросы на изменение веса бэкенда
+func (lb *LoadBalancer) UpdateBackendHandler(w http.ResponseWriter, r *http.Request) {
+	var req BackendWeightRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Weight <= 0 {
+		sendErrorResponse(w, r, http.StatusBadRequest, "weight must be positive")
+		return
+	}
+
+	lb.backendAction(w, r, "Backend updated successfully", func(host string) error {
+		return lb.SetBackendWeight(host, req.Weight)
+	})
+}
+
+// DeleteBackendHandler обрабатывает запросы на удаление бэкенда из пула
+func (lb *LoadBalancer) DeleteBackendHandler(w http.ResponseWriter, r *http.Request) {
+	host := mux.Vars(r)["host"]
+	if err := lb.RemoveBackend(host); err != nil {
+		sendErrorResponse(w, r, http.StatusNotFound, "Backend not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Backend removed successfully",
+	})
+}
+
+// DrainBackendHandler обрабатывает запросы на вывод бэкенда из работы
+func (lb *LoadBalancer) DrainBackendHandler(w http.ResponseWriter, r *http.Request) {
+	lb.backendAction(w, r, "Backend is draining", lb.DrainBackend)
+}
+
+// EnableBackendHandler обрабатывает запросы на включение бэкенда
+func (lb *LoadBalancer) EnableBackendHandler(w http.ResponseWriter, r *http.Request) {
+	lb.backendAction(w, r, "Backend enabled successfully", func(host string) error {
+		return lb.SetBackendEnabled(host, true)
+	})
+}
+
+// DisableBackendHandler обрабатывает запросы на выключение бэкенда
+func (lb *LoadBalancer) DisableBackendHandler(w http.ResponseWriter, r *http.Request) {
+	lb.backendAction(w, r, "Backend disabled successfully", func(host string) error {
+		return lb.SetBackendEnabled(host, false)
+	})
+}
+
+// backendAction выполняет действие над бэкендом из пути запроса и возвращает его новое состояние
+func (lb *LoadBalancer) backendAction(w http.ResponseWriter, r *http.Request, message string, action func(host string) error) {
+	host := mux.Vars(r)["host"]
+	if err := action(host); err != nil {
+		sendErrorResponse(w, r, http.StatusNotFound, "Backend not found")
+		return
+	}
+
+	lb.mutex.RLock()
+	server := lb.findServer(host)
+	var response BackendResponse
+	if server != nil {
+		response = newBackendResponse(server)
+	}
+	lb.mutex.RUnlock()
+
+	if server == nil {
+		sendErrorResponse(w, r, http.StatusNotFound, "Backend not found")
+		return
+	}
+	response.Message = message
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// newBackendResponse собирает информацию о сервере для API; вызывается под мьютексом
+func newBackendResponse(server *Server) BackendResponse {
+	response := BackendResponse{
+		URL:               server.URL.String(),
+		Host:              server.URL.Host,
+		Weight:            server.Weight,
+		State:             server.State().String(),
+		Healthy:           server.IsHealthy(),
+		Ejected:           server.IsEjected(),
+		CircuitBreaker:    server.BreakerState().String(),
+		ActiveConnections: server.ActiveConnections(),
+	}
+
+	if latency, ok := server.Latency(); ok {
+		response.LatencyMs = float64(latency) / float64(time.Millisecond)
+	}
+	return response
+}
+
+// RegisterRoutes регистрирует маршруты API балансировщика
+func (lb *LoadBalancer) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/circuit-breakers", lb.ListCircuitBreakersHandler).Methods("GET")
+	router.HandleFunc("/backends", lb.ListBackendsHandler).Methods("GET")
+	router.HandleFunc("/backends", lb.AddBackendHandler).Methods("POST")
+	router.HandleFunc("/backends/{host}", lb.GetBackendHandler).Methods("GET")
+	router.HandleFunc("/backends/{host}", lb.UpdateBackendHandler).Methods("PUT")
+	router.HandleFunc("/backends/{host}", lb.DeleteBackendHandler).Methods("DELETE")
+	router.HandleFunc("/backends/{host}/drain", lb.DrainBackendHandler).Methods("POST")
+	router.HandleFunc("/backends/{host}/enable", lb.EnableBackendHandler).Methods("POST")
+	router.HandleFunc("/backends/{host}/disable", lb.DisableBackendHandler).Methods("POST")
+}
+
+// sendErrorResponse отправляет структурированный JSON-ответ с ошибкой
+func sendErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Code:      statusCode,
+		Message:   message,
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
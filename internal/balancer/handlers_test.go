@@ -0,0 +1,103 @@
+package balancer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"load-balancer/internal/config"
+	"load-balancer/pkg/storage"
+)
+
+// doAdminRequest выполняет запрос к API балансировщика
+func doAdminRequest(router http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBackendsAPI(t *testing.T) {
+	one := newTestBackend(t, "one")
+	two := newTestBackend(t, "two")
+	twoHost := strings.TrimPrefix(two.URL, "http://")
+
+	lb := newTestLoadBalancer(t, config.BalancerConfig{Algorithm: "round-robin"}, one)
+	store := storage.NewMemoryStorage()
+	lb.SetStorage(store)
+
+	router := mux.NewRouter()
+	lb.RegisterRoutes(router)
+
+	rec := doAdminRequest(router, "POST", "/backends", `{"url": "`+two.URL+`", "weight": 2}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	rec = doAdminRequest(router, "POST", "/backends", `{"url": "`+two.URL+`"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = doAdminRequest(router, "GET", "/backends", "")
+	var backends []BackendResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&backends))
+	require.Len(t, backends, 2)
+	assert.Equal(t, twoHost, backends[1].Host)
+	assert.Equal(t, 2, backends[1].Weight)
+	assert.Equal(t, "active", backends[1].State)
+
+	// Выключенный бэкенд не получает запросов
+	rec = doAdminRequest(router, "POST", "/backends/"+strings.TrimPrefix(one.URL, "http://")+"/disable", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "two", doRequest(lb).Body.String())
+	}
+
+	rec = doAdminRequest(router, "PUT", "/backends/"+twoHost, `{"weight": 5}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	stored, err := store.LoadAllBackends()
+	require.NoError(t, err)
+	assert.Equal(t, []storage.Backend{
+		{URL: two.URL, Weight: 5, Enabled: true},
+		{URL: one.URL, Weight: 1, Enabled: false},
+	}, stored)
+
+	rec = doAdminRequest(router, "DELETE", "/backends/"+twoHost, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, lb.Servers(), 1)
+
+	rec = doAdminRequest(router, "POST", "/backends/"+twoHost+"/drain", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHealthCheckerFollowsServerChanges(t *testing.T) {
+	one := newTestBackend(t, "one")
+	lb := newTestLoadBalancer(t, config.BalancerConfig{Algorithm: "round-robin"}, one)
+
+	hc := newTestHealthChecker(t, lb.Servers(), config.HealthCheckConfig{})
+	lb.OnServersChange(hc.SetServers)
+	hc.Start()
+	defer hc.Stop()
+
+	two := newTestBackend(t, "two")
+	server, err := lb.AddBackend(config.BackendConfig{URL: two.URL, Weight: 1})
+	require.NoError(t, err)
+
+	hc.mutex.Lock()
+	assert.Len(t, hc.checks, 2)
+	assert.Contains(t, hc.checks, server)
+	hc.mutex.Unlock()
+
+	u, err := url.Parse(one.URL)
+	require.NoError(t, err)
+	require.NoError(t, lb.RemoveBackend(u.Host))
+
+	hc.mutex.Lock()
+	assert.Len(t, hc.checks, 1)
+	assert.Contains(t, hc.checks, server)
+	hc.mutex.Unlock()
+}
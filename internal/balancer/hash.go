@@ -0,0 +1,197 @@
+package balancer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"load-balancer/internal/config"
+	"load-balancer/pkg/clientip"
+)
+
+// virtualNodesPerWeight количество точек на кольце на единицу веса сервера
+const virtualNodesPerWeight = 100
+
+// HashKeyFunc извлекает из запроса ключ для consistent hashing
+type HashKeyFunc func(r *http.Request) string
+
+// ringEntry точка на кольце хешей
+type ringEntry struct {
+	hash   uint64
+	server *Server
+}
+
+// ConsistentHash реализует ring hash: один и тот же ключ попадает на один и тот же сервер,
+// а добавление или удаление сервера перераспределяет только ~1/N ключей
+type ConsistentHash struct {
+	keyFunc HashKeyFunc
+	ring    []ringEntry
+	members []*Server // Серверы, по которым построено кольцо
+	weights []int     // Веса серверов на момент построения кольца
+	mutex   sync.RWMutex
+}
+
+// NewConsistentHash создает новый ConsistentHash
+func NewConsistentHash(keyFunc HashKeyFunc) *ConsistentHash {
+	return &ConsistentHash{
+		keyFunc: keyFunc,
+	}
+}
+
+// NextServer выбирает сервер по хешу ключа запроса, пропуская недоступные серверы по кольцу
+func (ch *ConsistentHash) NextServer(servers []*Server, r *http.Request) *Server {
+	if len(servers) == 0 {
+		return nil
+	}
+
+	ring := ch.getRing(servers)
+	if len(ring) == 0 {
+		return nil
+	}
+
+	key := ""
+	if r != nil {
+		key = ch.keyFunc(r)
+	}
+	hash := hashKey(key)
+
+	start := sort.Search(len(ring), func(i int) bool {
+		return ring[i].hash >= hash
+	})
+
+	for i := 0; i < len(ring); i++ {
+		server := ring[(start+i)%len(ring)].server
+		if usable(server, r) {
+			return server
+		}
+	}
+
+	return nil
+}
+
+// getRing возвращает кольцо для текущего набора серверов, перестраивая его при изменениях
+func (ch *ConsistentHash) getRing(servers []*Server) []ringEntry {
+	ch.mutex.RLock()
+	if ch.sameServers(servers) {
+		ring := ch.ring
+		ch.mutex.RUnlock()
+		return ring
+	}
+	ch.mutex.RUnlock()
+
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+
+	if ch.sameServers(servers) {
+		return ch.ring
+	}
+
+	ring := make([]ringEntry, 0, len(servers)*virtualNodesPerWeight)
+	weights := make([]int, 0, len(servers))
+	for _, server := range servers {
+		weight := server.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		weights = append(weights, server.Weight)
+
+		for i := 0; i < weight*virtualNodesPerWeight; i++ {
+			ring = append(ring, ringEntry{
+				hash:   hashKey(server.URL.String() + "#" + strconv.Itoa(i)),
+				server: server,
+			})
+		}
+	}
+
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+
+	ch.ring = ring
+	ch.members = append([]*Server(nil), servers...)
+	ch.weights = weights
+	return ring
+}
+
+// sameServers проверяет, построено ли кольцо по тем же серверам с теми же весами.
+// Вызывается под блокировкой ch.mutex
+func (ch *ConsistentHash) sameServers(servers []*Server) bool {
+	if len(ch.members) != len(servers) {
+		return false
+	}
+	for i := range servers {
+		if ch.members[i] != servers[i] || ch.weights[i] != servers[i].Weight {
+			return false
+		}
+	}
+	return true
+}
+
+// hashKey вычисляет 64-битный хеш строки (FNV-1a с финальным перемешиванием битов)
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+
+	// Финализатор murmur3 улучшает распределение близких строк по кольцу
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// newHashKeyFunc создает функцию извлечения ключа по настройкам
+func newHashKeyFunc(cfg config.HashKeyConfig) (HashKeyFunc, error) {
+	switch cfg.Source {
+	case "", "ip":
+		return clientIP, nil
+	case "api-key":
+		return withIPFallback(func(r *http.Request) string {
+			return r.Header.Get("X-API-Key")
+		}), nil
+	case "header":
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("не указано имя заголовка для ключа хеширования")
+		}
+		return withIPFallback(func(r *http.Request) string {
+			return r.Header.Get(cfg.Name)
+		}), nil
+	case "cookie":
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("не указано имя cookie для ключа хеширования")
+		}
+		return withIPFallback(func(r *http.Request) string {
+			cookie, err := r.Cookie(cfg.Name)
+			if err != nil {
+				return ""
+			}
+			return cookie.Value
+		}), nil
+	case "path":
+		return func(r *http.Request) string {
+			return r.URL.Path
+		}, nil
+	default:
+		return nil, fmt.Errorf("неизвестный источник ключа хеширования: %s", cfg.Source)
+	}
+}
+
+// withIPFallback использует IP клиента, если в запросе нет нужного ключа
+func withIPFallback(keyFunc HashKeyFunc) HashKeyFunc {
+	return func(r *http.Request) string {
+		if key := keyFunc(r); key != "" {
+			return key
+		}
+		return clientIP(r)
+	}
+}
+
+// clientIP возвращает IP-адрес клиента без порта с учетом доверенных прокси
+func clientIP(r *http.Request) string {
+	return clientip.FromRequest(r)
+}
@@ -1,102 +1,268 @@
 package balancer
 
 import (
+	"context"
 	"fmt"
-	"net/http"
+	"math/rand"
+	"sync"
 	"time"
 
+	"load-balancer/internal/config"
 	"load-balancer/internal/logger"
 )
 
 // HealthChecker выполняет проверку доступности серверов
 type HealthChecker struct {
-	servers        []*Server
-	checkInterval  time.Duration
-	healthEndpoint string
-	client         *http.Client
-	logger         *logger.Logger
-	stopChan       chan struct{}
+	servers []*Server
+	cfg     config.HealthCheckConfig
+	probers map[string]Prober // Проверки по типам: http, tcp, grpc
+	logger  *logger.Logger
+	metrics Metrics
+	running bool
+	checks  map[*Server]chan struct{} // Каналы остановки циклов проверки серверов
+	mutex   sync.Mutex
+}
+
+// serverCheck хранит счетчики подряд идущих результатов проверок сервера
+type serverCheck struct {
+	server    *Server
+	interval  time.Duration
+	successes int
+	failures  int
 }
 
 // NewHealthChecker создает новый checker для проверки здоровья серверов
-func NewHealthChecker(servers []*Server, interval time.Duration, endpoint string, logger *logger.Logger) *HealthChecker {
+func NewHealthChecker(servers []*Server, cfg config.HealthCheckConfig, logger *logger.Logger) (*HealthChecker, error) {
+	probers, err := newProbers(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	return &HealthChecker{
-		servers:        servers,
-		checkInterval:  interval,
-		healthEndpoint: endpoint,
-		client: &http.Client{
-			Timeout: 5 * time.Second,
-		},
-		logger:   logger,
-		stopChan: make(chan struct{}),
+		servers: servers,
+		cfg:     cfg,
+		probers: probers,
+		logger:  logger,
+		metrics: noopMetrics{},
+		checks:  make(map[*Server]chan struct{}),
+	}, nil
+}
+
+// newProbers создает проверки всех типов по настройкам
+func newProbers(cfg config.HealthCheckConfig) (map[string]Prober, error) {
+	tlsConfig, err := newHealthCheckTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	httpProber, err := newHTTPProber(cfg, tlsConfig)
+	if err != nil {
+		return nil, err
 	}
+
+	return map[string]Prober{
+		"http": httpProber,
+		"tcp":  newTCPProber(),
+		"grpc": newGRPCProber(cfg.GRPCService, tlsConfig),
+	}, nil
 }
 
-// Start запускает периодическую проверку серверов
-func (hc *HealthChecker) Start() {
-	ticker := time.NewTicker(hc.checkInterval)
-
-	go func() {
-		hc.checkServers()
-
-		for {
-			select {
-			case <-ticker.C:
-				hc.checkServers()
-			case <-hc.stopChan:
-				ticker.Stop()
-				return
-			}
+// HealthCheckSettings проверенные настройки проверки здоровья с созданными по ним
+// проверками. Применяются методом Apply, который не может завершиться ошибкой
+type HealthCheckSettings struct {
+	cfg     config.HealthCheckConfig
+	probers map[string]Prober
+}
+
+// NewHealthCheckSettings проверяет настройки и создает по ним проверки
+func NewHealthCheckSettings(cfg config.HealthCheckConfig) (*HealthCheckSettings, error) {
+	probers, err := newProbers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &HealthCheckSettings{cfg: cfg, probers: probers}, nil
+}
+
+// SetConfig применяет новые настройки проверки здоровья. Запущенные проверки
+// перезапускаются с новыми интервалами, счетчики результатов сбрасываются
+func (hc *HealthChecker) SetConfig(cfg config.HealthCheckConfig) error {
+	settings, err := NewHealthCheckSettings(cfg)
+	if err != nil {
+		return err
+	}
+	hc.Apply(settings)
+	return nil
+}
+
+// Apply применяет подготовленные настройки так же, как SetConfig
+func (hc *HealthChecker) Apply(settings *HealthCheckSettings) {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	hc.cfg = settings.cfg
+	hc.probers = settings.probers
+
+	for server, stop := range hc.checks {
+		close(stop)
+		delete(hc.checks, server)
+	}
+	if hc.running {
+		for _, server := range hc.servers {
+			hc.startCheck(server)
 		}
-	}()
+	}
 }
 
-// Stop останавливает проверки здоровья
-func (hc *HealthChecker) Stop() {
-	close(hc.stopChan)
+// config возвращает текущие настройки и проверки
+func (hc *HealthChecker) config() (config.HealthCheckConfig, map[string]Prober) {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+	return hc.cfg, hc.probers
 }
 
-// checkServers проверяет доступность всех серверов
-func (hc *HealthChecker) checkServers() {
+// Start запускает периодическую проверку серверов, у каждого сервера свой цикл
+func (hc *HealthChecker) Start() {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
+
+	hc.running = true
 	for _, server := range hc.servers {
-		go hc.checkServer(server)
+		hc.startCheck(server)
 	}
 }
 
-// checkServer проверяет доступность отдельного сервера
-func (hc *HealthChecker) checkServer(server *Server) {
-	healthURL := fmt.Sprintf("http://%s%s", server.URL.Host, hc.healthEndpoint)
+// Stop останавливает проверки здоровья
+func (hc *HealthChecker) Stop() {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
 
-	req, err := http.NewRequest("GET", healthURL, nil)
-	if err != nil {
-		hc.logger.Errorf("Ошибка создания запроса для %s: %v", server.URL.Host, err)
-		return
+	hc.running = false
+	for server, stop := range hc.checks {
+		close(stop)
+		delete(hc.checks, server)
 	}
+}
 
-	resp, err := hc.client.Do(req)
+// SetServers заменяет список проверяемых серверов. Если проверки запущены,
+// циклы удаленных серверов останавливаются, а для новых запускаются
+func (hc *HealthChecker) SetServers(servers []*Server) {
+	hc.mutex.Lock()
+	defer hc.mutex.Unlock()
 
-	wasHealthy := server.IsHealthy()
+	hc.servers = servers
+	if !hc.running {
+		return
+	}
 
-	if err != nil {
-		server.SetHealth(false)
-		if wasHealthy {
-			hc.logger.Warnf("Сервер %s помечен как недоступный: %v", server.URL.Host, err)
+	current := make(map[*Server]bool, len(servers))
+	for _, server := range servers {
+		current[server] = true
+		if _, ok := hc.checks[server]; !ok {
+			hc.startCheck(server)
 		}
+	}
+
+	for server, stop := range hc.checks {
+		if !current[server] {
+			close(stop)
+			delete(hc.checks, server)
+		}
+	}
+}
+
+// startCheck запускает цикл проверки сервера; вызывается под мьютексом
+func (hc *HealthChecker) startCheck(server *Server) {
+	if _, ok := hc.checks[server]; ok {
 		return
 	}
 
-	defer resp.Body.Close()
+	interval := hc.cfg.Interval
+	if server.HealthCheck.Interval > 0 {
+		interval = server.HealthCheck.Interval
+	}
+
+	stop := make(chan struct{})
+	hc.checks[server] = stop
+	go hc.run(&serverCheck{server: server, interval: interval}, stop)
+}
+
+// run периодически проверяет сервер. Случайная добавка к интервалу
+// не дает проверкам разных серверов синхронизироваться
+func (hc *HealthChecker) run(check *serverCheck, stop <-chan struct{}) {
+	timer := time.NewTimer(hc.jitter())
+	defer timer.Stop()
 
-	if resp.StatusCode != http.StatusOK {
-		server.SetHealth(false)
-		if wasHealthy {
-			hc.logger.Warnf("Сервер %s помечен как недоступный: код ответа %d", server.URL.Host, resp.StatusCode)
+	for {
+		select {
+		case <-timer.C:
+			hc.checkServer(check)
+			timer.Reset(check.interval + hc.jitter())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// jitter возвращает случайную задержку в пределах настроенного разброса
+func (hc *HealthChecker) jitter() time.Duration {
+	cfg, _ := hc.config()
+	if cfg.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(cfg.Jitter)))
+}
+
+// checkServer проверяет доступность отдельного сервера и меняет его состояние
+// только после заданного количества подряд идущих одинаковых результатов
+func (hc *HealthChecker) checkServer(check *serverCheck) {
+	server := check.server
+	cfg, _ := hc.config()
+	err := hc.probe(server)
+
+	if err != nil {
+		check.successes = 0
+		check.failures++
+
+		if server.IsHealthy() && check.failures >= cfg.UnhealthyThreshold {
+			server.SetHealth(false)
+			hc.metrics.ObserveHealthTransition(server.URL.Host, false)
+			hc.logger.Warnw("Сервер помечен как недоступный", "backend", server.URL.Host, "failures", check.failures, "error", err)
 		}
 		return
 	}
 
-	server.SetHealth(true)
-	if !wasHealthy {
-		hc.logger.Infof("Сервер %s снова доступен", server.URL.Host)
+	check.failures = 0
+	check.successes++
+
+	if !server.IsHealthy() && check.successes >= cfg.HealthyThreshold {
+		server.SetHealth(true)
+		hc.metrics.ObserveHealthTransition(server.URL.Host, true)
+		hc.logger.Infow("Сервер снова доступен", "backend", server.URL.Host, "successes", check.successes)
+	}
+
+	// Сервер, исключенный по живому трафику, возвращается в пул только после
+	// истечения времени исключения и успешной активной проверки
+	if server.readmit() {
+		hc.logger.Infof("Сервер %s возвращен в пул после исключения", server.URL.Host)
 	}
 }
+
+// probe выполняет одну проверку сервера проверкой выбранного для него типа
+func (hc *HealthChecker) probe(server *Server) error {
+	cfg, probers := hc.config()
+
+	probeType := cfg.Type
+	if server.HealthCheck.Type != "" {
+		probeType = server.HealthCheck.Type
+	}
+
+	prober, ok := probers[probeType]
+	if !ok {
+		return fmt.Errorf("неизвестный тип проверки здоровья: %s", probeType)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	return prober.Probe(ctx, server)
+}
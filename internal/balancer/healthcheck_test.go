@@ -0,0 +1,238 @@
+package balancer
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"load-balancer/internal/config"
+	"load-balancer/internal/logger"
+)
+
+// newTestHealthChecker создает checker с настройками по умолчанию и переопределениями из cfg
+func newTestHealthChecker(t *testing.T, servers []*Server, cfg config.HealthCheckConfig) *HealthChecker {
+	t.Helper()
+
+	if cfg.Type == "" {
+		cfg.Type = "http"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "/health"
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = time.Second
+	}
+	if cfg.HealthyThreshold == 0 {
+		cfg.HealthyThreshold = 1
+	}
+	if cfg.UnhealthyThreshold == 0 {
+		cfg.UnhealthyThreshold = 1
+	}
+	if len(cfg.ExpectedStatuses) == 0 {
+		cfg.ExpectedStatuses = []string{"200"}
+	}
+	if cfg.Method == "" {
+		cfg.Method = http.MethodGet
+	}
+
+	hc, err := NewHealthChecker(servers, cfg, logger.NewLoggerWithLevel(logger.FatalLevel, io.Discard))
+	require.NoError(t, err)
+	return hc
+}
+
+// serverFor создает здоровый сервер для httptest-бэкенда
+func serverFor(t *testing.T, backend *httptest.Server) *Server {
+	t.Helper()
+	u, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+	server := &Server{URL: u, Weight: 1}
+	server.SetHealth(true)
+	return server
+}
+
+func TestHealthCheckThresholds(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer backend.Close()
+
+	server := serverFor(t, backend)
+	hc := newTestHealthChecker(t, []*Server{server}, config.HealthCheckConfig{
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 3,
+		ExpectedStatuses:   []string{"200-299"},
+	})
+	check := &serverCheck{server: server}
+
+	status.Store(http.StatusServiceUnavailable)
+	hc.checkServer(check)
+	hc.checkServer(check)
+	assert.True(t, server.IsHealthy(), "состояние не должно меняться до достижения порога")
+	hc.checkServer(check)
+	assert.False(t, server.IsHealthy())
+
+	status.Store(http.StatusNoContent)
+	hc.checkServer(check)
+	assert.False(t, server.IsHealthy())
+	hc.checkServer(check)
+	assert.True(t, server.IsHealthy())
+}
+
+func TestHealthCheckRequestAndBodyMatch(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead && r.Host == "health.internal" && r.Header.Get("X-Check") == "1" {
+			io.WriteString(w, `{"status":"ok"}`)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer backend.Close()
+
+	server := serverFor(t, backend)
+	hc := newTestHealthChecker(t, []*Server{server}, config.HealthCheckConfig{
+		Host:         "health.internal",
+		Headers:      map[string]string{"X-Check": "1"},
+		BodyContains: "status",
+		BodyRegex:    `"status":\s*"ok"`,
+	})
+	assert.NoError(t, hc.probe(server))
+
+	hc = newTestHealthChecker(t, []*Server{server}, config.HealthCheckConfig{
+		Host:      "health.internal",
+		Headers:   map[string]string{"X-Check": "1"},
+		BodyRegex: `"status":\s*"degraded"`,
+	})
+	assert.Error(t, hc.probe(server))
+}
+
+func TestHealthCheckReusesConnection(t *testing.T) {
+	var connections atomic.Int32
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("ok", 8<<10))
+	}))
+	backend.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+
+	// Тело не нужно для проверки, но дочитывается, и соединение переиспользуется
+	server := serverFor(t, backend)
+	hc := newTestHealthChecker(t, []*Server{server}, config.HealthCheckConfig{})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, hc.probe(server))
+	}
+	assert.Equal(t, int32(1), connections.Load())
+}
+
+func TestParseStatusRanges(t *testing.T) {
+	ranges, err := parseStatusRanges([]string{"200", "300-399"})
+	require.NoError(t, err)
+	assert.Equal(t, []statusRange{{200, 200}, {300, 399}}, ranges)
+
+	_, err = parseStatusRanges([]string{"399-300"})
+	assert.Error(t, err)
+	_, err = parseStatusRanges([]string{"abc"})
+	assert.Error(t, err)
+}
+
+func TestHealthCheckURL(t *testing.T) {
+	hc := newTestHealthChecker(t, nil, config.HealthCheckConfig{Endpoint: "/health"})
+	prober := hc.probers["http"].(*httpProber)
+
+	withPrefix := &Server{URL: &url.URL{Scheme: "https", Host: "api.example:8443", Path: "/v1/"}}
+	assert.Equal(t, "https://api.example:8443/v1/health", prober.healthURL(withPrefix))
+
+	override := &Server{
+		URL: &url.URL{Scheme: "http", Host: "[::1]:8080", Path: "/app"},
+		HealthCheck: config.BackendHealthCheckConfig{
+			Endpoint: "/status",
+			Port:     9090,
+		},
+	}
+	assert.Equal(t, "http://[::1]:9090/status", prober.healthURL(override))
+}
+
+func TestHealthCheckHTTPS(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/base/health" {
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer backend.Close()
+
+	server := serverFor(t, backend)
+	server.URL.Path = "/base"
+
+	// Самоподписанный сертификат не проходит проверку по умолчанию
+	hc := newTestHealthChecker(t, []*Server{server}, config.HealthCheckConfig{})
+	assert.Error(t, hc.probe(server))
+
+	hc = newTestHealthChecker(t, []*Server{server}, config.HealthCheckConfig{
+		TLS: config.HealthCheckTLS{InsecureSkipVerify: true},
+	})
+	assert.NoError(t, hc.probe(server))
+}
+
+func TestTCPProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &Server{
+		URL:         &url.URL{Scheme: "http", Host: listener.Addr().String()},
+		HealthCheck: config.BackendHealthCheckConfig{Type: "tcp"},
+	}
+	hc := newTestHealthChecker(t, []*Server{server}, config.HealthCheckConfig{})
+	assert.NoError(t, hc.probe(server))
+
+	listener.Close()
+	assert.Error(t, hc.probe(server))
+}
+
+func TestGRPCProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("api", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("worker", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	grpcServer := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+
+	server := &Server{
+		URL:         &url.URL{Scheme: "http", Host: listener.Addr().String()},
+		HealthCheck: config.BackendHealthCheckConfig{Type: "grpc", GRPCService: "api"},
+	}
+	hc := newTestHealthChecker(t, []*Server{server}, config.HealthCheckConfig{})
+	assert.NoError(t, hc.probe(server))
+
+	server.HealthCheck.GRPCService = "worker"
+	assert.Error(t, hc.probe(server))
+
+	server.HealthCheck.GRPCService = "unknown"
+	assert.Error(t, hc.probe(server))
+}
@@ -0,0 +1,49 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// Metrics получает события балансировщика и проверки здоровья для сбора метрик
+type Metrics interface {
+	ObserveUpstream(backend, method string, statusCode int, latency time.Duration)
+	IncRetry(backend string)
+	IncProxyError(backend, reason string)
+	ObserveHealthTransition(backend string, healthy bool)
+}
+
+// noopMetrics используется, пока метрики не подключены
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveUpstream(string, string, int, time.Duration) {}
+func (noopMetrics) IncRetry(string)                                    {}
+func (noopMetrics) IncProxyError(string, string)                       {}
+func (noopMetrics) ObserveHealthTransition(string, bool)               {}
+
+// SetMetrics подключает сбор метрик. Вызывается до начала обработки запросов
+func (lb *LoadBalancer) SetMetrics(metrics Metrics) {
+	lb.metrics = metrics
+}
+
+// SetMetrics подключает сбор метрик. Вызывается до Start
+func (hc *HealthChecker) SetMetrics(metrics Metrics) {
+	hc.metrics = metrics
+}
+
+// proxyErrorReason возвращает причину ошибки проксирования для метрик
+func proxyErrorReason(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case isDialError(err):
+		return "dial"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,163 @@
+package balancer
+
+import (
+	"sync"
+	"time"
+
+	"load-balancer/internal/config"
+	"load-balancer/internal/logger"
+)
+
+// outlierStats статистика живого трафика сервера для пассивной проверки здоровья
+type outlierStats struct {
+	consecutive5xx    int
+	consecutiveErrors int
+	windowStart       time.Time
+	windowRequests    int
+	windowFailures    int
+	ejectionCount     int       // Количество исключений подряд, определяет длительность следующего
+	ejectedUntil      time.Time // Время, до которого сервер исключен из пула
+	mutex             sync.Mutex
+}
+
+// outlierDetector исключает из пула серверы, которые отвечают ошибками на живой трафик
+type outlierDetector struct {
+	cfg    config.OutlierDetectionConfig
+	lb     *LoadBalancer
+	logger *logger.Logger
+	mutex  sync.Mutex // Проверка доли исключенных и исключение выполняются атомарно
+}
+
+// newOutlierDetector создает детектор выбросов для балансировщика
+func newOutlierDetector(cfg config.OutlierDetectionConfig, lb *LoadBalancer, logger *logger.Logger) *outlierDetector {
+	return &outlierDetector{
+		cfg:    cfg,
+		lb:     lb,
+		logger: logger,
+	}
+}
+
+// record учитывает результат запроса к серверу: код ответа или ошибку соединения
+func (od *outlierDetector) record(server *Server, statusCode int, connErr bool) {
+	failure := connErr || statusCode >= 500
+	now := time.Now()
+
+	stats := &server.outlier
+	stats.mutex.Lock()
+
+	// Новое окно статистики; если за прошлое окно сервер не исключался, уменьшаем кратность
+	if now.Sub(stats.windowStart) > od.cfg.Interval {
+		if stats.ejectionCount > 0 && !server.IsEjected() {
+			stats.ejectionCount--
+		}
+		stats.windowStart = now
+		stats.windowRequests = 0
+		stats.windowFailures = 0
+	}
+
+	stats.windowRequests++
+	if failure {
+		stats.windowFailures++
+	}
+
+	if failure {
+		stats.consecutive5xx++
+	} else {
+		stats.consecutive5xx = 0
+	}
+
+	if connErr {
+		stats.consecutiveErrors++
+	} else {
+		stats.consecutiveErrors = 0
+	}
+
+	reason := ""
+	switch {
+	case server.IsEjected():
+		// Уже исключен, например, запрос завершился после исключения
+	case stats.consecutiveErrors >= od.cfg.ConsecutiveErrors:
+		reason = "ошибки соединения подряд"
+	case stats.consecutive5xx >= od.cfg.Consecutive5xx:
+		reason = "ответы 5xx подряд"
+	case od.cfg.FailureRate > 0 && stats.windowRequests >= od.cfg.FailureRateMinVolume &&
+		float64(stats.windowFailures)/float64(stats.windowRequests) >= od.cfg.FailureRate:
+		reason = "доля ошибок в окне"
+	}
+	stats.mutex.Unlock()
+
+	if reason != "" {
+		od.eject(server, reason)
+	}
+}
+
+// eject исключает сервер из пула на экспоненциально растущее время,
+// если не превышена максимальная доля исключенных серверов
+func (od *outlierDetector) eject(server *Server, reason string) {
+	od.mutex.Lock()
+	defer od.mutex.Unlock()
+
+	// Сервер мог исключить параллельный запрос, пока мы ждали блокировку
+	if server.IsEjected() {
+		return
+	}
+
+	servers := od.lb.Servers()
+
+	ejected := 0
+	for _, s := range servers {
+		if s.IsEjected() {
+			ejected++
+		}
+	}
+
+	// Хотя бы один сервер можно исключить всегда
+	if ejected > 0 && (ejected+1)*100 > od.cfg.MaxEjectionPercent*len(servers) {
+		od.logger.Warnf("Сервер %s не исключен (%s): достигнута максимальная доля исключенных серверов", server.URL.Host, reason)
+		return
+	}
+
+	stats := &server.outlier
+	stats.mutex.Lock()
+	duration := od.cfg.BaseEjectionTime
+	for i := 0; i < stats.ejectionCount && duration < od.cfg.MaxEjectionTime; i++ {
+		duration *= 2
+	}
+	if duration > od.cfg.MaxEjectionTime {
+		duration = od.cfg.MaxEjectionTime
+	}
+	stats.ejectionCount++
+	stats.ejectedUntil = time.Now().Add(duration)
+	stats.consecutive5xx = 0
+	stats.consecutiveErrors = 0
+	stats.windowStart = time.Now()
+	stats.windowRequests = 0
+	stats.windowFailures = 0
+	stats.mutex.Unlock()
+
+	server.ejected.Store(true)
+	od.logger.Warnf("Сервер %s исключен из пула на %v: %s", server.URL.Host, duration, reason)
+}
+
+// IsEjected проверяет, исключен ли сервер пассивной проверкой здоровья
+func (s *Server) IsEjected() bool {
+	return s.ejected.Load()
+}
+
+// readmit возвращает исключенный сервер в пул, если время исключения истекло.
+// Вызывается активной проверкой здоровья после успешной пробы
+func (s *Server) readmit() bool {
+	if !s.IsEjected() {
+		return false
+	}
+
+	s.outlier.mutex.Lock()
+	defer s.outlier.mutex.Unlock()
+
+	if time.Now().Before(s.outlier.ejectedUntil) {
+		return false
+	}
+
+	s.ejected.Store(false)
+	return true
+}
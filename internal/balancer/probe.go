@@ -0,0 +1,277 @@
+package balancer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"load-balancer/internal/config"
+)
+
+// maxHealthBodySize ограничивает объем тела ответа, читаемого для проверки
+const maxHealthBodySize = 64 * 1024
+
+// Prober выполняет одну проверку здоровья сервера
+type Prober interface {
+	Probe(ctx context.Context, server *Server) error
+}
+
+// statusRange диапазон допустимых кодов ответа
+type statusRange struct {
+	from, to int
+}
+
+// httpProber проверяет сервер HTTP-запросом
+type httpProber struct {
+	cfg      config.HealthCheckConfig
+	statuses []statusRange
+	bodyRe   *regexp.Regexp
+	client   *http.Client
+}
+
+// newHTTPProber создает HTTP-проверку по настройкам
+func newHTTPProber(cfg config.HealthCheckConfig, tlsConfig *tls.Config) (*httpProber, error) {
+	statuses, err := parseStatusRanges(cfg.ExpectedStatuses)
+	if err != nil {
+		return nil, err
+	}
+
+	var bodyRe *regexp.Regexp
+	if cfg.BodyRegex != "" {
+		bodyRe, err = regexp.Compile(cfg.BodyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("неверное регулярное выражение для тела ответа: %v", err)
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &httpProber{
+		cfg:      cfg,
+		statuses: statuses,
+		bodyRe:   bodyRe,
+		client:   &http.Client{Transport: transport},
+	}, nil
+}
+
+// healthURL строит адрес проверки с учетом схемы, префикса пути и переопределений бэкенда
+func (p *httpProber) healthURL(server *Server) string {
+	scheme := server.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	host := server.URL.Host
+	if server.HealthCheck.Port > 0 {
+		host = net.JoinHostPort(server.URL.Hostname(), strconv.Itoa(server.HealthCheck.Port))
+	}
+
+	path := strings.TrimSuffix(server.URL.Path, "/") + p.cfg.Endpoint
+	if server.HealthCheck.Endpoint != "" {
+		path = server.HealthCheck.Endpoint
+	}
+
+	u := url.URL{Scheme: scheme, Host: host, Path: path}
+	return u.String()
+}
+
+// Probe выполняет одну HTTP-проверку сервера
+func (p *httpProber) Probe(ctx context.Context, server *Server) error {
+	healthURL := p.healthURL(server)
+
+	req, err := http.NewRequestWithContext(ctx, p.cfg.Method, healthURL, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %v", err)
+	}
+
+	for name, value := range p.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+	if p.cfg.Host != "" {
+		req.Host = p.cfg.Host
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Дочитываем тело, чтобы соединение вернулось в пул и следующая проверка
+		// не открывала новое
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxHealthBodySize))
+		resp.Body.Close()
+	}()
+
+	if !p.statusAllowed(resp.StatusCode) {
+		return fmt.Errorf("код ответа %d", resp.StatusCode)
+	}
+
+	if p.cfg.BodyContains == "" && p.bodyRe == nil {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthBodySize))
+	if err != nil {
+		return fmt.Errorf("ошибка чтения ответа: %v", err)
+	}
+
+	if p.cfg.BodyContains != "" && !strings.Contains(string(body), p.cfg.BodyContains) {
+		return fmt.Errorf("ответ не содержит %q", p.cfg.BodyContains)
+	}
+	if p.bodyRe != nil && !p.bodyRe.Match(body) {
+		return fmt.Errorf("ответ не соответствует выражению %q", p.cfg.BodyRegex)
+	}
+
+	return nil
+}
+
+// statusAllowed проверяет, входит ли код ответа в допустимые диапазоны
+func (p *httpProber) statusAllowed(code int) bool {
+	for _, r := range p.statuses {
+		if code >= r.from && code <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// tcpProber проверяет, что сервер принимает TCP-соединения
+type tcpProber struct {
+	dialer net.Dialer
+}
+
+// newTCPProber создает TCP-проверку
+func newTCPProber() *tcpProber {
+	return &tcpProber{}
+}
+
+// Probe устанавливает и сразу закрывает TCP-соединение с сервером
+func (p *tcpProber) Probe(ctx context.Context, server *Server) error {
+	conn, err := p.dialer.DialContext(ctx, "tcp", probeAddress(server))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// grpcProber проверяет сервер по протоколу grpc.health.v1.Health/Check
+type grpcProber struct {
+	service   string
+	tlsConfig *tls.Config
+}
+
+// newGRPCProber создает gRPC-проверку
+func newGRPCProber(service string, tlsConfig *tls.Config) *grpcProber {
+	return &grpcProber{
+		service:   service,
+		tlsConfig: tlsConfig,
+	}
+}
+
+// Probe вызывает Health/Check и требует статус SERVING
+func (p *grpcProber) Probe(ctx context.Context, server *Server) error {
+	creds := insecure.NewCredentials()
+	if server.URL.Scheme == "https" {
+		creds = credentials.NewTLS(p.tlsConfig)
+	}
+
+	conn, err := grpc.NewClient(probeAddress(server), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("ошибка создания gRPC-клиента: %v", err)
+	}
+	defer conn.Close()
+
+	service := p.service
+	if server.HealthCheck.GRPCService != "" {
+		service = server.HealthCheck.GRPCService
+	}
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return err
+	}
+
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("gRPC-статус %s", resp.GetStatus())
+	}
+	return nil
+}
+
+// probeAddress возвращает host:port для проверки с учетом переопределения порта
+func probeAddress(server *Server) string {
+	port := server.URL.Port()
+	if server.HealthCheck.Port > 0 {
+		port = strconv.Itoa(server.HealthCheck.Port)
+	}
+	if port == "" {
+		port = "80"
+		if server.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	return net.JoinHostPort(server.URL.Hostname(), port)
+}
+
+// parseStatusRanges разбирает коды ответа вида "200" и диапазоны вида "200-399"
+func parseStatusRanges(values []string) ([]statusRange, error) {
+	ranges := make([]statusRange, 0, len(values))
+
+	for _, value := range values {
+		fromStr, toStr, isRange := strings.Cut(strings.TrimSpace(value), "-")
+		if !isRange {
+			toStr = fromStr
+		}
+
+		from, err := strconv.Atoi(strings.TrimSpace(fromStr))
+		if err != nil {
+			return nil, fmt.Errorf("неверный код ответа для проверки здоровья: %s", value)
+		}
+		to, err := strconv.Atoi(strings.TrimSpace(toStr))
+		if err != nil || to < from {
+			return nil, fmt.Errorf("неверный диапазон кодов ответа для проверки здоровья: %s", value)
+		}
+
+		ranges = append(ranges, statusRange{from: from, to: to})
+	}
+
+	return ranges, nil
+}
+
+// newHealthCheckTLSConfig создает настройки TLS для проверки https-бэкендов
+func newHealthCheckTLSConfig(cfg config.HealthCheckTLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		ServerName:         cfg.ServerName,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения CA для проверки здоровья: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("в файле %s нет корректных сертификатов", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,101 @@
+package balancer
+
+import (
+	"fmt"
+	"net/url"
+
+	"load-balancer/internal/config"
+)
+
+// Reload применяет новый список бэкендов и настройки балансировки без остановки приема запросов.
+// Серверы с тем же URL сохраняют свое состояние, новые добавляются, удаленные перестают
+// получать запросы и выводятся из работы после завершения активных. При ошибке в настройках
+// текущая конфигурация не меняется
+func (lb *LoadBalancer) Reload(backends []config.BackendConfig, balancerCfg config.BalancerConfig) error {
+	urls := make([]string, len(backends))
+	for i, backendCfg := range backends {
+		parsed, err := url.Parse(backendCfg.URL)
+		if err != nil {
+			return fmt.Errorf("неверный формат URL %s: %v", backendCfg.URL, err)
+		}
+		urls[i] = parsed.String()
+	}
+
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	algorithm := lb.algorithm
+	oldCfg := lb.opts.cfg
+	if balancerCfg.Algorithm != oldCfg.Algorithm || balancerCfg.HashKey != oldCfg.HashKey {
+		var err error
+		algorithm, err = newAlgorithm(balancerCfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	existing := make(map[string]*Server, len(lb.servers))
+	for _, server := range lb.servers {
+		existing[server.URL.String()] = server
+	}
+
+	servers := make([]*Server, 0, len(backends))
+	kept := make(map[*Server]bool, len(backends))
+	var added []*Server
+
+	for i, backendCfg := range backends {
+		server, ok := existing[urls[i]]
+		// Сервер с другими настройками проверки здоровья заменяется новым
+		if ok && !kept[server] && server.HealthCheck == backendCfg.HealthCheck {
+			kept[server] = true
+			servers = append(servers, server)
+			continue
+		}
+
+		server, err := lb.newServer(backendCfg, balancerCfg.CircuitBreaker)
+		if err != nil {
+			return err
+		}
+		added = append(added, server)
+		servers = append(servers, server)
+	}
+
+	// Дальше ошибок быть не может, применяем изменения
+	for i, server := range servers {
+		if !kept[server] {
+			continue
+		}
+
+		weight := backends[i].Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		server.Weight = weight
+
+		if balancerCfg.CircuitBreaker != oldCfg.CircuitBreaker {
+			server.setCircuitBreaker(balancerCfg.CircuitBreaker, lb.logger)
+		}
+	}
+
+	for _, server := range added {
+		lb.logger.Infof("Сервер %s добавлен в пул", server.URL.Host)
+	}
+
+	for _, server := range lb.servers {
+		if !kept[server] {
+			lb.logger.Infof("Сервер %s удален из пула", server.URL.Host)
+			go lb.drain(server)
+		}
+	}
+
+	if algorithm != lb.algorithm {
+		lb.logger.Infof("Алгоритм балансировки изменен: %s -> %s", oldCfg.Algorithm, balancerCfg.Algorithm)
+	}
+
+	lb.servers = servers
+	lb.algorithm = algorithm
+	lb.opts = lb.newOptions(balancerCfg)
+	lb.notify()
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package balancer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"load-balancer/internal/config"
+)
+
+// retryBudgetWindow окно, в котором считается бюджет повторов
+const retryBudgetWindow = 10 * time.Second
+
+// maxRetainedBody наибольшее тело отброшенного ответа 502/503/504, которое
+// сохраняется, чтобы передать его клиенту, если повторить запрос негде
+const maxRetainedBody = 64 << 10
+
+// errRetryableStatus возвращается из ModifyResponse, чтобы отбросить ответ 502/503/504 и повторить запрос
+var errRetryableStatus = errors.New("бэкенд вернул код ответа, допускающий повтор")
+
+// attemptKey ключ контекста для состояния попытки проксирования
+type attemptKey struct{}
+
+// attempt хранит состояние одной попытки проксирования запроса
+type attempt struct {
+	canRetry      bool              // Попытку можно повторить при ошибке соединения
+	retryOnStatus bool              // Попытку можно повторить при ответе 502/503/504
+	failed        bool              // Попытка не удалась, ответ клиенту не записан
+	err           error             // Ошибка неудачной попытки
+	statusCode    int               // Код ответа бэкенда
+	proxyErr      error             // Ошибка проксирования (соединение, таймаут, отмена)
+	response      *retainedResponse // Ответ бэкенда, отброшенный ради повтора
+	tried         map[*Server]bool  // Серверы, уже использованные для запроса
+	budget        *retryBudget      // Бюджет повторов, с которым начал обрабатываться запрос
+	breaker       *circuitBreaker   // Выключатель, в котором зарезервирована попытка
+}
+
+// retainedResponse ответ бэкенда, отброшенный ради повтора
+type retainedResponse struct {
+	statusCode int
+	header     http.Header
+	body       []byte // nil, если тело больше maxRetainedBody
+}
+
+// retainResponse сохраняет код, заголовки и небольшое тело ответа
+func retainResponse(resp *http.Response) *retainedResponse {
+	retained := &retainedResponse{statusCode: resp.StatusCode, header: resp.Header.Clone()}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRetainedBody+1))
+	if err == nil && len(body) <= maxRetainedBody {
+		retained.body = body
+	}
+	return retained
+}
+
+// write отправляет сохраненный ответ клиенту. Если тело не сохранено, передаются
+// код и Retry-After бэкенда с описанием ошибки в JSON
+func (resp *retainedResponse) write(w http.ResponseWriter, r *http.Request) {
+	if resp.body == nil {
+		if retryAfter := resp.header.Get("Retry-After"); retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		sendErrorResponse(w, r, resp.statusCode, http.StatusText(resp.statusCode))
+		return
+	}
+
+	for name, values := range resp.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.statusCode)
+	w.Write(resp.body)
+}
+
+// attemptFromContext возвращает состояние попытки из контекста запроса
+func attemptFromContext(ctx context.Context) *attempt {
+	a, _ := ctx.Value(attemptKey{}).(*attempt)
+	return a
+}
+
+// usable проверяет, можно ли направить запрос на сервер: сервер доступен
+// и не использовался в предыдущих попытках этого запроса
+func usable(server *Server, r *http.Request) bool {
+	if !server.IsAvailable() {
+		return false
+	}
+	if r == nil {
+		return true
+	}
+	if a := attemptFromContext(r.Context()); a != nil && a.tried[server] {
+		return false
+	}
+	return true
+}
+
+// retryBudget ограничивает долю повторов, чтобы они не усиливали нагрузку при сбое
+type retryBudget struct {
+	ratio        float64
+	minPerSecond int
+	windowStart  time.Time
+	requests     int
+	retries      int
+	mutex        sync.Mutex
+}
+
+// newRetryBudget создает бюджет повторов по настройкам
+func newRetryBudget(cfg config.RetryConfig) *retryBudget {
+	return &retryBudget{
+		ratio:        cfg.BudgetRatio,
+		minPerSecond: cfg.MinRetriesPerSecond,
+		windowStart:  time.Now(),
+	}
+}
+
+// resetIfExpired начинает новое окно. Вызывается под блокировкой
+func (b *retryBudget) resetIfExpired(now time.Time) {
+	if now.Sub(b.windowStart) > retryBudgetWindow {
+		b.windowStart = now
+		b.requests = 0
+		b.retries = 0
+	}
+}
+
+// recordRequest учитывает новый входящий запрос
+func (b *retryBudget) recordRequest() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.resetIfExpired(time.Now())
+	b.requests++
+}
+
+// tryWithdraw резервирует один повтор, если бюджет не исчерпан
+func (b *retryBudget) tryWithdraw() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.resetIfExpired(time.Now())
+
+	allowed := float64(b.minPerSecond)*retryBudgetWindow.Seconds() + b.ratio*float64(b.requests)
+	if float64(b.retries) >= allowed {
+		return false
+	}
+
+	b.retries++
+	return true
+}
+
+// bufferBody читает небольшое тело запроса в память, чтобы его можно было отправить повторно.
+// Возвращает false, если тело слишком большое и запрос повторять нельзя
+func bufferBody(r *http.Request, maxBytes int64) ([]byte, bool, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true, nil
+	}
+	if r.ContentLength > maxBytes {
+		return nil, false, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(body)) > maxBytes {
+		// Тело оказалось больше лимита - отдаем прочитанное и остаток без возможности повтора
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil, false, nil
+	}
+
+	r.Body.Close()
+	return body, true, nil
+}
+
+// isIdempotent проверяет, можно ли безопасно повторить запрос после ответа бэкенда
+func isIdempotent(r *http.Request, idempotencyHeader string) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return idempotencyHeader != "" && r.Header.Get(idempotencyHeader) != ""
+}
+
+// isRetryableStatus проверяет, допускает ли код ответа повтор на другом бэкенде
+func isRetryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// isDialError проверяет, что соединение с бэкендом не было установлено
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
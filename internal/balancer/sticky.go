@@ -0,0 +1,128 @@
+package balancer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"load-balancer/internal/config"
+)
+
+// stickySessions привязывает клиента к бэкенду с помощью подписанной cookie
+type stickySessions struct {
+	cookieName string
+	ttl        time.Duration
+	secret     []byte
+}
+
+// newStickySessions создает обработчик sticky-сессий по настройкам
+func newStickySessions(cfg config.StickySessionConfig) *stickySessions {
+	return &stickySessions{
+		cookieName: cfg.CookieName,
+		ttl:        cfg.TTL,
+		secret:     []byte(cfg.Secret),
+	}
+}
+
+// lookup возвращает сервер из cookie запроса, если подпись верна и сервер доступен
+func (ss *stickySessions) lookup(r *http.Request, servers []*Server) *Server {
+	cookie, err := r.Cookie(ss.cookieName)
+	if err != nil {
+		return nil
+	}
+
+	backend, ok := ss.verify(cookie.Value)
+	if !ok {
+		return nil
+	}
+
+	for _, server := range servers {
+		if server.URL.String() == backend {
+			if usable(server, r) {
+				return server
+			}
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// setCookie добавляет в ответ cookie с выбранным сервером, заменяя выданную
+// при предыдущей попытке проксирования этого же запроса
+func (ss *stickySessions) setCookie(w http.ResponseWriter, r *http.Request, server *Server) {
+	header := w.Header()
+	cookies := header["Set-Cookie"][:0]
+	for _, cookie := range header["Set-Cookie"] {
+		if !strings.HasPrefix(cookie, ss.cookieName+"=") {
+			cookies = append(cookies, cookie)
+		}
+	}
+	if len(cookies) == 0 {
+		header.Del("Set-Cookie")
+	} else {
+		header["Set-Cookie"] = cookies
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     ss.cookieName,
+		Value:    ss.sign(server.URL.String(), time.Now().Add(ss.ttl)),
+		Path:     "/",
+		MaxAge:   int(ss.ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sign формирует значение cookie: бэкенд и срок действия, подписанные HMAC
+func (ss *stickySessions) sign(backend string, expires time.Time) string {
+	payload := backend + "|" + strconv.FormatInt(expires.Unix(), 10)
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(ss.mac(payload))
+}
+
+// verify проверяет подпись и срок действия cookie и возвращает адрес бэкенда
+func (ss *stickySessions) verify(value string) (string, bool) {
+	encoded, signature, found := strings.Cut(value, ".")
+	if !found {
+		return "", false
+	}
+
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return "", false
+	}
+
+	payload := string(payloadBytes)
+	if !hmac.Equal(mac, ss.mac(payload)) {
+		return "", false
+	}
+
+	sep := strings.LastIndex(payload, "|")
+	if sep < 0 {
+		return "", false
+	}
+
+	expires, err := strconv.ParseInt(payload[sep+1:], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", false
+	}
+
+	return payload[:sep], true
+}
+
+// mac вычисляет HMAC-SHA256 от содержимого cookie
+func (ss *stickySessions) mac(payload string) []byte {
+	h := hmac.New(sha256.New, ss.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
@@ -0,0 +1,71 @@
+package balancer
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer создает спаны выбора бэкенда и запросов к нему. Пока трассировка
+// не настроена, спаны ничего не стоят и не записываются
+var tracer = otel.Tracer("load-balancer/internal/balancer")
+
+// startSelectSpan начинает спан выбора бэкенда для попытки try
+func startSelectSpan(r *http.Request, opts *options, try int) trace.Span {
+	_, span := tracer.Start(r.Context(), "select backend", trace.WithAttributes(
+		attribute.String("lb.algorithm", opts.cfg.Algorithm),
+		attribute.Int("lb.retry_count", try),
+	))
+	return span
+}
+
+// endSelectSpan завершает спан выбора бэкенда
+func endSelectSpan(span trace.Span, server *Server) {
+	if server == nil {
+		span.SetStatus(codes.Error, "no available backends")
+	} else {
+		span.SetAttributes(attribute.String("lb.backend", server.URL.Host))
+	}
+	span.End()
+}
+
+// startUpstreamSpan начинает клиентский спан запроса к бэкенду. Его контекст
+// передает бэкенду injectTraceContext
+func startUpstreamSpan(r *http.Request, server *Server, try int) (context.Context, trace.Span) {
+	return tracer.Start(r.Context(), "proxy "+server.URL.Host,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("server.address", server.URL.Host),
+			attribute.String("http.request.method", r.Method),
+			attribute.Int("lb.retry_count", try),
+		),
+	)
+}
+
+// injectTraceContext записывает контекст спана попытки в заголовки
+// traceparent/tracestate исходящего запроса. Вызывается из Director для копии,
+// которую прокси создает на каждую попытку, поэтому входящий запрос не меняется
+func injectTraceContext(outreq *http.Request) {
+	otel.GetTextMapPropagator().Inject(outreq.Context(), propagation.HeaderCarrier(outreq.Header))
+}
+
+// endUpstreamSpan записывает в спан результат попытки и завершает его
+func endUpstreamSpan(span trace.Span, state *attempt) {
+	switch {
+	case state == nil:
+	case state.proxyErr != nil:
+		span.RecordError(state.proxyErr)
+		span.SetStatus(codes.Error, proxyErrorReason(state.proxyErr))
+	default:
+		span.SetAttributes(attribute.Int("http.response.status_code", state.statusCode))
+		if state.failed || state.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(state.statusCode))
+		}
+	}
+	span.End()
+}
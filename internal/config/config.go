@@ -3,7 +3,10 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -15,27 +18,43 @@ type Config struct {
 		Port string `yaml:"port"`
 	} `yaml:"server"`
 
-	Backends []string `yaml:"backends"`
+	Backends []BackendConfig `yaml:"backends"`
 
-	HealthCheck struct {
-		Endpoint string        `yaml:"endpoint"`
-		Interval time.Duration `yaml:"interval"`
-	} `yaml:"healthcheck"`
+	HealthCheck HealthCheckConfig `yaml:"healthcheck"`
 
-	Balancer struct {
-		Algorithm string `yaml:"algorithm"`
-	} `yaml:"balancer"`
+	Balancer BalancerConfig `yaml:"balancer"`
+
+	Reload ReloadConfig `yaml:"reload"`
+
+	Shutdown ShutdownConfig `yaml:"shutdown"`
+
+	Health HealthConfig `yaml:"health"`
+
+	Metrics MetricsConfig `yaml:"metrics"`
+
+	Logging LoggingConfig `yaml:"logging"`
+
+	AccessLog AccessLogConfig `yaml:"access_log"`
+
+	RequestID RequestIDConfig `yaml:"request_id"`
+
+	ClientIP ClientIPConfig `yaml:"client_ip"`
+
+	Tracing TracingConfig `yaml:"tracing"`
 
 	RateLimit struct {
 		Default struct {
+			Algorithm  string  `yaml:"algorithm"`
 			Capacity   int     `yaml:"capacity"`
 			RefillRate float64 `yaml:"refill_rate"`
 		} `yaml:"default"`
+		Distributed DistributedRateLimitConfig `yaml:"distributed"`
 	} `yaml:"ratelimit"`
 
 	Storage struct {
-		Type     string `yaml:"type"` // "memory" или "postgres"
-		Postgres struct {
+		Type            string `yaml:"type"`             // "memory" или "postgres"
+		PersistBackends bool   `yaml:"persist_backends"` // Сохранять пул бэкендов, измененный через API
+		Postgres        struct {
 			Host     string `yaml:"host"`
 			Port     int    `yaml:"port"`
 			User     string `yaml:"user"`
@@ -46,6 +65,205 @@ type Config struct {
 	} `yaml:"storage"`
 }
 
+// BackendConfig содержит настройки отдельного бэкенд-сервера
+type BackendConfig struct {
+	URL         string                   `yaml:"url"`
+	Weight      int                      `yaml:"weight"` // Вес для weighted-round-robin
+	HealthCheck BackendHealthCheckConfig `yaml:"healthcheck"`
+}
+
+// BackendHealthCheckConfig переопределяет настройки проверки здоровья для отдельного бэкенда
+type BackendHealthCheckConfig struct {
+	Type        string        `yaml:"type"`         // "http", "tcp" или "grpc"
+	GRPCService string        `yaml:"grpc_service"` // Имя сервиса для grpc.health.v1.Health/Check
+	Endpoint    string        `yaml:"endpoint"`     // Полный путь проверки, без учета префикса из URL бэкенда
+	Port        int           `yaml:"port"`         // Отдельный порт, например порт управления
+	Interval    time.Duration `yaml:"interval"`
+}
+
+// UnmarshalYAML позволяет задавать бэкенд как строкой с URL, так и объектом
+func (b *BackendConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&b.URL)
+	}
+
+	// Отдельный тип, чтобы избежать рекурсивного вызова UnmarshalYAML
+	type plain BackendConfig
+	return value.Decode((*plain)(b))
+}
+
+// HealthCheckConfig содержит настройки активной проверки здоровья бэкендов
+type HealthCheckConfig struct {
+	Type               string            `yaml:"type"`         // "http", "tcp" или "grpc"
+	GRPCService        string            `yaml:"grpc_service"` // Имя сервиса для grpc.health.v1.Health/Check
+	Endpoint           string            `yaml:"endpoint"`
+	Interval           time.Duration     `yaml:"interval"`
+	Timeout            time.Duration     `yaml:"timeout"`             // Таймаут одной проверки
+	Jitter             time.Duration     `yaml:"jitter"`              // Случайная добавка к интервалу
+	HealthyThreshold   int               `yaml:"healthy_threshold"`   // Успешных проверок подряд для возврата в пул
+	UnhealthyThreshold int               `yaml:"unhealthy_threshold"` // Неудачных проверок подряд для исключения
+	ExpectedStatuses   []string          `yaml:"expected_statuses"`   // Коды или диапазоны, например "200-399"
+	BodyContains       string            `yaml:"body_contains"`       // Подстрока, которая должна быть в ответе
+	BodyRegex          string            `yaml:"body_regex"`          // Регулярное выражение для тела ответа
+	Method             string            `yaml:"method"`
+	Headers            map[string]string `yaml:"headers"`
+	Host               string            `yaml:"host"` // Значение заголовка Host
+	TLS                HealthCheckTLS    `yaml:"tls"`
+}
+
+// HealthCheckTLS содержит настройки TLS для проверки https-бэкендов
+type HealthCheckTLS struct {
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	CAFile             string `yaml:"ca_file"`     // PEM-файл с корневыми сертификатами
+	ServerName         string `yaml:"server_name"` // Имя для проверки сертификата
+}
+
+// ReloadConfig содержит настройки перезагрузки конфигурации без перезапуска
+type ReloadConfig struct {
+	Watch    bool          `yaml:"watch"`    // Следить за изменением файла конфигурации
+	Interval time.Duration `yaml:"interval"` // Период проверки времени изменения файла
+}
+
+// BalancerConfig содержит настройки алгоритма балансировки
+type BalancerConfig struct {
+	Algorithm     string              `yaml:"algorithm"`
+	HashKey       HashKeyConfig       `yaml:"hash_key"` // Ключ для consistent-hash
+	StickySession StickySessionConfig `yaml:"sticky_session"`
+
+	OutlierDetection OutlierDetectionConfig `yaml:"outlier_detection"`
+
+	Retry RetryConfig `yaml:"retry"`
+
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+
+	DrainTimeout time.Duration `yaml:"drain_timeout"` // Ожидание завершения запросов к выводимому бэкенду и при остановке
+}
+
+// LoggingConfig содержит настройки логирования
+type LoggingConfig struct {
+	Level  string `yaml:"level"`  // "debug", "info", "warn" или "error"
+	Format string `yaml:"format"` // "text", "json" или "logfmt"
+	Colors *bool  `yaml:"colors"` // Цвета в формате text; по умолчанию - только при выводе в терминал
+	Output string `yaml:"output"` // "stdout", "stderr" или путь к файлу
+}
+
+// AccessLogConfig содержит настройки журнала запросов
+type AccessLogConfig struct {
+	Enabled           bool     `yaml:"enabled"`
+	Format            string   `yaml:"format"`              // "combined", "json" или "template"
+	Template          string   `yaml:"template"`            // Шаблон text/template для формата template
+	Output            string   `yaml:"output"`              // "stdout", "stderr" или путь к файлу
+	MaxSizeMB         int64    `yaml:"max_size_mb"`         // Размер файла для ротации, 0 - без ротации
+	MaxBackups        int      `yaml:"max_backups"`         // Сколько старых файлов хранить
+	SuccessSampleRate *float64 `yaml:"success_sample_rate"` // Доля записываемых успешных запросов (0..1), по умолчанию все
+}
+
+// RequestIDConfig содержит настройки идентификатора запроса X-Request-ID
+type RequestIDConfig struct {
+	TrustIncoming   bool     `yaml:"trust_incoming"`   // Принимать идентификатор от клиента вместо генерации
+	TrustedNetworks []string `yaml:"trusted_networks"` // Сети (CIDR), от которых он принимается; пусто - от любых
+}
+
+// ClientIPConfig определяет, как вычисляется IP-адрес клиента
+type ClientIPConfig struct {
+	TrustedProxies []string `yaml:"trusted_proxies"` // Прокси (CIDR), от которых принимаются X-Forwarded-For, X-Real-IP и Forwarded
+	IPv4Prefix     int      `yaml:"ipv4_prefix"`     // Агрегация IPv4-клиентов в rate limiter по сети, например 24
+	IPv6Prefix     int      `yaml:"ipv6_prefix"`     // Агрегация IPv6-клиентов в rate limiter по сети, например 64
+}
+
+// TracingConfig содержит настройки трассировки OpenTelemetry
+type TracingConfig struct {
+	Enabled     bool     `yaml:"enabled"`
+	ServiceName string   `yaml:"service_name"`
+	Exporter    string   `yaml:"exporter"`     // "otlp", "stdout" или "file"
+	Protocol    string   `yaml:"protocol"`     // Протокол OTLP: "grpc" или "http"
+	Endpoint    string   `yaml:"endpoint"`     // Адрес коллектора host:port
+	Insecure    bool     `yaml:"insecure"`     // Подключаться к коллектору без TLS
+	File        string   `yaml:"file"`         // Путь к файлу для экспортера file
+	SampleRatio *float64 `yaml:"sample_ratio"` // Доля трасс (0..1), начинаемых балансировщиком; по умолчанию все
+}
+
+// DistributedRateLimitConfig содержит настройки ограничения, общего для нескольких
+// экземпляров балансировщика
+type DistributedRateLimitConfig struct {
+	Enabled   bool          `yaml:"enabled"`
+	Backend   string        `yaml:"backend"`    // "redis" или "postgres" (настройки из storage.postgres)
+	KeyPrefix string        `yaml:"key_prefix"` // Префикс ключей ведер
+	BatchSize int           `yaml:"batch_size"` // Токенов, резервируемых за одно обращение к хранилищу
+	Timeout   time.Duration `yaml:"timeout"`    // Таймаут обращения к хранилищу
+	Redis     struct {
+		Address  string `yaml:"address"`
+		Password string `yaml:"password"`
+		DB       int    `yaml:"db"`
+		PoolSize int    `yaml:"pool_size"`
+	} `yaml:"redis"`
+}
+
+// MetricsConfig содержит настройки эндпоинта метрик Prometheus
+type MetricsConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Path       string `yaml:"path"`
+	MaxClients int    `yaml:"max_clients"` // Клиентов с отдельной меткой, остальные учитываются как "other"
+}
+
+// HealthConfig содержит настройки эндпоинтов liveness и readiness самого балансировщика
+type HealthConfig struct {
+	LivenessPath       string `yaml:"liveness_path"`
+	ReadinessPath      string `yaml:"readiness_path"`
+	MinHealthyBackends int    `yaml:"min_healthy_backends"` // Минимум доступных бэкендов для готовности
+}
+
+// ShutdownConfig содержит настройки корректного завершения работы
+type ShutdownConfig struct {
+	PreStopDelay time.Duration `yaml:"pre_stop_delay"` // Пауза после снятия готовности, чтобы внешний балансировщик перестал слать запросы
+}
+
+// CircuitBreakerConfig содержит настройки автоматического выключателя для каждого бэкенда
+type CircuitBreakerConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	FailureRatio     float64       `yaml:"failure_ratio"`      // Доля ошибок (0..1) для размыкания
+	MinRequests      int           `yaml:"min_requests"`       // Минимум запросов в окне для оценки доли
+	Window           time.Duration `yaml:"window"`             // Окно статистики в замкнутом состоянии
+	OpenDuration     time.Duration `yaml:"open_duration"`      // Время в разомкнутом состоянии
+	HalfOpenRequests int           `yaml:"half_open_requests"` // Пробных запросов в полуразомкнутом состоянии
+}
+
+// RetryConfig содержит настройки повторных попыток на другом бэкенде
+type RetryConfig struct {
+	MaxRetries          int     `yaml:"max_retries"`            // 0 - повторы выключены
+	IdempotencyHeader   string  `yaml:"idempotency_header"`     // Заголовок, разрешающий повтор неидемпотентных запросов
+	MaxBodyBytes        int64   `yaml:"max_body_bytes"`         // Запросы с телом больше не повторяются
+	BudgetRatio         float64 `yaml:"budget_ratio"`           // Доля повторов от числа запросов
+	MinRetriesPerSecond int     `yaml:"min_retries_per_second"` // Повторы, разрешенные независимо от доли
+}
+
+// OutlierDetectionConfig содержит настройки пассивной проверки здоровья по живому трафику
+type OutlierDetectionConfig struct {
+	Enabled              bool          `yaml:"enabled"`
+	Consecutive5xx       int           `yaml:"consecutive_5xx"`         // Подряд идущих ответов 5xx до исключения
+	ConsecutiveErrors    int           `yaml:"consecutive_errors"`      // Подряд идущих ошибок соединения до исключения
+	FailureRate          float64       `yaml:"failure_rate"`            // Доля ошибок в окне (0..1), 0 - не проверять
+	FailureRateMinVolume int           `yaml:"failure_rate_min_volume"` // Минимум запросов в окне для проверки доли ошибок
+	Interval             time.Duration `yaml:"interval"`                // Размер окна статистики
+	BaseEjectionTime     time.Duration `yaml:"base_ejection_time"`      // Время первого исключения, удваивается при повторах
+	MaxEjectionTime      time.Duration `yaml:"max_ejection_time"`
+	MaxEjectionPercent   int           `yaml:"max_ejection_percent"` // Максимальная доля исключенных серверов пула
+}
+
+// StickySessionConfig содержит настройки привязки клиента к бэкенду через cookie
+type StickySessionConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	CookieName string        `yaml:"cookie_name"`
+	TTL        time.Duration `yaml:"ttl"`
+	Secret     string        `yaml:"secret"` // Ключ для подписи cookie (HMAC-SHA256)
+}
+
+// HashKeyConfig определяет, по какой части запроса вычисляется хеш
+type HashKeyConfig struct {
+	Source string `yaml:"source"` // "api-key", "header", "cookie", "path" или "ip"
+	Name   string `yaml:"name"`   // Имя заголовка или cookie
+}
+
 // LoadConfig загружает конфигурацию из файла
 func LoadConfig(path string) (*Config, error) {
 	// Проверяем на переменные окружения
@@ -73,6 +291,33 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("не указаны бэкенд-серверы")
 	}
 
+	for i := range config.Backends {
+		backend := &config.Backends[i]
+		if backend.URL == "" {
+			return nil, fmt.Errorf("не указан URL для бэкенда #%d", i+1)
+		}
+		if backend.Weight < 0 {
+			return nil, fmt.Errorf("отрицательный вес для бэкенда %s: %d", backend.URL, backend.Weight)
+		}
+		if backend.Weight == 0 {
+			backend.Weight = 1 // Вес по умолчанию
+		}
+		if !validHealthCheckType(backend.HealthCheck.Type) {
+			return nil, fmt.Errorf("неизвестный тип проверки здоровья для бэкенда %s: %s", backend.URL, backend.HealthCheck.Type)
+		}
+		if backend.HealthCheck.Port < 0 || backend.HealthCheck.Port > 65535 {
+			return nil, fmt.Errorf("неверный порт проверки здоровья для бэкенда %s: %d", backend.URL, backend.HealthCheck.Port)
+		}
+	}
+
+	if config.HealthCheck.Type == "" {
+		config.HealthCheck.Type = "http" // Тип проверки по умолчанию
+	}
+
+	if !validHealthCheckType(config.HealthCheck.Type) {
+		return nil, fmt.Errorf("неизвестный тип проверки здоровья: %s", config.HealthCheck.Type)
+	}
+
 	if config.HealthCheck.Endpoint == "" {
 		config.HealthCheck.Endpoint = "/health" // Эндпоинт по умолчанию
 	}
@@ -81,10 +326,265 @@ func LoadConfig(path string) (*Config, error) {
 		config.HealthCheck.Interval = 5 * time.Second // Интервал по умолчанию
 	}
 
+	if config.HealthCheck.Timeout == 0 {
+		config.HealthCheck.Timeout = 5 * time.Second
+	}
+
+	if config.HealthCheck.HealthyThreshold == 0 {
+		config.HealthCheck.HealthyThreshold = 1
+	}
+
+	if config.HealthCheck.UnhealthyThreshold == 0 {
+		config.HealthCheck.UnhealthyThreshold = 1
+	}
+
+	if len(config.HealthCheck.ExpectedStatuses) == 0 {
+		config.HealthCheck.ExpectedStatuses = []string{"200"}
+	}
+
+	if config.HealthCheck.Method == "" {
+		config.HealthCheck.Method = http.MethodGet
+	}
+
 	if config.Balancer.Algorithm == "" {
 		config.Balancer.Algorithm = "round-robin" // Алгоритм по умолчанию
 	}
 
+	if config.Balancer.HashKey.Source == "" {
+		config.Balancer.HashKey.Source = "ip" // Ключ хеширования по умолчанию
+	}
+
+	// Настройки пассивной проверки здоровья
+	outlier := &config.Balancer.OutlierDetection
+	if outlier.Consecutive5xx == 0 {
+		outlier.Consecutive5xx = 5
+	}
+	if outlier.ConsecutiveErrors == 0 {
+		outlier.ConsecutiveErrors = 3
+	}
+	if outlier.FailureRateMinVolume == 0 {
+		outlier.FailureRateMinVolume = 20
+	}
+	if outlier.Interval == 0 {
+		outlier.Interval = 10 * time.Second
+	}
+	if outlier.BaseEjectionTime == 0 {
+		outlier.BaseEjectionTime = 30 * time.Second
+	}
+	if outlier.MaxEjectionTime == 0 {
+		outlier.MaxEjectionTime = 5 * time.Minute
+	}
+	if outlier.MaxEjectionPercent == 0 {
+		outlier.MaxEjectionPercent = 50
+	}
+	if outlier.FailureRate < 0 || outlier.FailureRate > 1 {
+		return nil, fmt.Errorf("доля ошибок для outlier detection должна быть в диапазоне 0..1: %v", outlier.FailureRate)
+	}
+
+	// Настройки повторных попыток
+	retry := &config.Balancer.Retry
+	if retry.MaxRetries < 0 {
+		return nil, fmt.Errorf("отрицательное количество повторов: %d", retry.MaxRetries)
+	}
+	if retry.IdempotencyHeader == "" {
+		retry.IdempotencyHeader = "Idempotency-Key"
+	}
+	if retry.MaxBodyBytes == 0 {
+		retry.MaxBodyBytes = 64 * 1024
+	}
+	if retry.BudgetRatio == 0 {
+		retry.BudgetRatio = 0.2
+	}
+	if retry.MinRetriesPerSecond == 0 {
+		retry.MinRetriesPerSecond = 10
+	}
+
+	// Настройки автоматического выключателя
+	breaker := &config.Balancer.CircuitBreaker
+	if breaker.FailureRatio == 0 {
+		breaker.FailureRatio = 0.5
+	}
+	if breaker.FailureRatio < 0 || breaker.FailureRatio > 1 {
+		return nil, fmt.Errorf("доля ошибок для circuit breaker должна быть в диапазоне 0..1: %v", breaker.FailureRatio)
+	}
+	if breaker.MinRequests == 0 {
+		breaker.MinRequests = 20
+	}
+	if breaker.Window == 0 {
+		breaker.Window = 10 * time.Second
+	}
+	if breaker.OpenDuration == 0 {
+		breaker.OpenDuration = 30 * time.Second
+	}
+	if breaker.HalfOpenRequests == 0 {
+		breaker.HalfOpenRequests = 3
+	}
+
+	if config.Balancer.DrainTimeout == 0 {
+		config.Balancer.DrainTimeout = 30 * time.Second
+	}
+
+	// Настройки sticky-сессий
+	if config.Balancer.StickySession.Enabled {
+		if config.Balancer.StickySession.Secret == "" {
+			return nil, fmt.Errorf("не указан секрет для подписи cookie sticky-сессий")
+		}
+		if config.Balancer.StickySession.CookieName == "" {
+			config.Balancer.StickySession.CookieName = "lb_backend"
+		}
+		if config.Balancer.StickySession.TTL == 0 {
+			config.Balancer.StickySession.TTL = time.Hour
+		}
+	}
+
+	if config.Health.LivenessPath == "" {
+		config.Health.LivenessPath = "/healthz"
+	}
+	if config.Health.ReadinessPath == "" {
+		config.Health.ReadinessPath = "/readyz"
+	}
+	if !strings.HasPrefix(config.Health.LivenessPath, "/") || !strings.HasPrefix(config.Health.ReadinessPath, "/") {
+		return nil, fmt.Errorf("пути liveness и readiness должны начинаться с /")
+	}
+	if config.Health.MinHealthyBackends == 0 {
+		config.Health.MinHealthyBackends = 1
+	}
+	if config.Health.MinHealthyBackends < 0 {
+		return nil, fmt.Errorf("отрицательное минимальное количество доступных бэкендов: %d", config.Health.MinHealthyBackends)
+	}
+
+	// Настройки логирования
+	if config.Logging.Level == "" {
+		config.Logging.Level = "info"
+	}
+	switch config.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return nil, fmt.Errorf("неизвестный уровень логирования: %s", config.Logging.Level)
+	}
+	if config.Logging.Format == "" {
+		config.Logging.Format = "text"
+	}
+	switch config.Logging.Format {
+	case "text", "json", "logfmt":
+	default:
+		return nil, fmt.Errorf("неизвестный формат логов: %s", config.Logging.Format)
+	}
+	if config.Logging.Output == "" {
+		config.Logging.Output = "stdout"
+	}
+
+	// Настройки журнала запросов
+	accessLog := &config.AccessLog
+	if accessLog.Format == "" {
+		accessLog.Format = "combined"
+	}
+	switch accessLog.Format {
+	case "combined", "json":
+	case "template":
+		if accessLog.Template == "" {
+			return nil, fmt.Errorf("не указан шаблон для формата access log template")
+		}
+	default:
+		return nil, fmt.Errorf("неизвестный формат access log: %s", accessLog.Format)
+	}
+	if accessLog.Output == "" {
+		accessLog.Output = "stdout"
+	}
+	if accessLog.MaxSizeMB < 0 || accessLog.MaxBackups < 0 {
+		return nil, fmt.Errorf("размер файла и количество старых файлов access log не могут быть отрицательными")
+	}
+	if accessLog.SuccessSampleRate == nil {
+		rate := 1.0
+		accessLog.SuccessSampleRate = &rate
+	}
+	if *accessLog.SuccessSampleRate < 0 || *accessLog.SuccessSampleRate > 1 {
+		return nil, fmt.Errorf("доля записываемых успешных запросов должна быть в диапазоне 0..1: %v", *accessLog.SuccessSampleRate)
+	}
+
+	for _, cidr := range config.RequestID.TrustedNetworks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return nil, fmt.Errorf("неверная доверенная сеть для X-Request-ID: %s", cidr)
+		}
+	}
+
+	// Определение IP-адреса клиента
+	for _, cidr := range config.ClientIP.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return nil, fmt.Errorf("неверная сеть доверенных прокси: %s", cidr)
+		}
+	}
+	if config.ClientIP.IPv4Prefix == 0 {
+		config.ClientIP.IPv4Prefix = 32
+	}
+	if config.ClientIP.IPv6Prefix == 0 {
+		config.ClientIP.IPv6Prefix = 128
+	}
+	if config.ClientIP.IPv4Prefix < 1 || config.ClientIP.IPv4Prefix > 32 {
+		return nil, fmt.Errorf("длина префикса IPv4 должна быть в диапазоне 1..32: %d", config.ClientIP.IPv4Prefix)
+	}
+	if config.ClientIP.IPv6Prefix < 1 || config.ClientIP.IPv6Prefix > 128 {
+		return nil, fmt.Errorf("длина префикса IPv6 должна быть в диапазоне 1..128: %d", config.ClientIP.IPv6Prefix)
+	}
+
+	// Настройки трассировки
+	tracing := &config.Tracing
+	if tracing.ServiceName == "" {
+		tracing.ServiceName = "load-balancer"
+	}
+	if tracing.Exporter == "" {
+		tracing.Exporter = "otlp"
+	}
+	if tracing.Protocol == "" {
+		tracing.Protocol = "grpc"
+	}
+	switch tracing.Protocol {
+	case "grpc":
+		if tracing.Endpoint == "" {
+			tracing.Endpoint = "localhost:4317"
+		}
+	case "http":
+		if tracing.Endpoint == "" {
+			tracing.Endpoint = "localhost:4318"
+		}
+	default:
+		return nil, fmt.Errorf("неизвестный протокол OTLP: %s", tracing.Protocol)
+	}
+	switch tracing.Exporter {
+	case "otlp", "stdout":
+	case "file":
+		if tracing.File == "" {
+			return nil, fmt.Errorf("не указан файл для экспортера трассировки file")
+		}
+	default:
+		return nil, fmt.Errorf("неизвестный экспортер трассировки: %s", tracing.Exporter)
+	}
+	if tracing.SampleRatio == nil {
+		ratio := 1.0
+		tracing.SampleRatio = &ratio
+	}
+	if *tracing.SampleRatio < 0 || *tracing.SampleRatio > 1 {
+		return nil, fmt.Errorf("доля трасс должна быть в диапазоне 0..1: %v", *tracing.SampleRatio)
+	}
+
+	if config.Metrics.Path == "" {
+		config.Metrics.Path = "/metrics"
+	}
+	if !strings.HasPrefix(config.Metrics.Path, "/") {
+		return nil, fmt.Errorf("путь метрик должен начинаться с /: %s", config.Metrics.Path)
+	}
+	if config.Metrics.MaxClients == 0 {
+		config.Metrics.MaxClients = 100
+	}
+
+	if config.Shutdown.PreStopDelay < 0 {
+		return nil, fmt.Errorf("отрицательная пауза перед остановкой: %v", config.Shutdown.PreStopDelay)
+	}
+
+	if config.Reload.Interval == 0 {
+		config.Reload.Interval = 2 * time.Second
+	}
+
 	if config.RateLimit.Default.Capacity == 0 {
 		config.RateLimit.Default.Capacity = 100 // Емкость по умолчанию
 	}
@@ -93,13 +593,52 @@ func LoadConfig(path string) (*Config, error) {
 		config.RateLimit.Default.RefillRate = 10 // Скорость пополнения по умолчанию
 	}
 
+	if config.RateLimit.Default.Capacity < 0 || config.RateLimit.Default.RefillRate < 0 {
+		return nil, fmt.Errorf("отрицательные настройки лимита по умолчанию: capacity=%d, refill_rate=%.2f",
+			config.RateLimit.Default.Capacity, config.RateLimit.Default.RefillRate)
+	}
+
+	if config.RateLimit.Default.Algorithm == "" {
+		config.RateLimit.Default.Algorithm = "token-bucket"
+	}
+	if !validRateLimitAlgorithm(config.RateLimit.Default.Algorithm) {
+		return nil, fmt.Errorf("неизвестный алгоритм ограничения: %s", config.RateLimit.Default.Algorithm)
+	}
+
+	// Распределенное ограничение частоты
+	distributed := &config.RateLimit.Distributed
+	if distributed.Backend == "" {
+		distributed.Backend = "redis"
+	}
+	if distributed.Backend != "redis" && distributed.Backend != "postgres" {
+		return nil, fmt.Errorf("неизвестное хранилище распределенного rate limiting: %s", distributed.Backend)
+	}
+	if distributed.KeyPrefix == "" {
+		distributed.KeyPrefix = "ratelimit:"
+	}
+	if distributed.BatchSize == 0 {
+		distributed.BatchSize = 1
+	}
+	if distributed.BatchSize < 0 {
+		return nil, fmt.Errorf("отрицательный размер пачки токенов: %d", distributed.BatchSize)
+	}
+	if distributed.Timeout == 0 {
+		distributed.Timeout = 100 * time.Millisecond
+	}
+	if distributed.Redis.Address == "" {
+		distributed.Redis.Address = "localhost:6379"
+	}
+	if distributed.Redis.PoolSize == 0 {
+		distributed.Redis.PoolSize = 10
+	}
+
 	// Настройки хранилища
 	if config.Storage.Type == "" {
 		config.Storage.Type = "memory"
 	}
 
-	// Валидация настроек PostgreSQL
-	if config.Storage.Type == "postgres" {
+	// Валидация настроек PostgreSQL; они же используются распределенным rate limiting
+	if config.Storage.Type == "postgres" || (distributed.Enabled && distributed.Backend == "postgres") {
 		if config.Storage.Postgres.Host == "" {
 			config.Storage.Postgres.Host = "localhost"
 		}
@@ -119,3 +658,23 @@ func LoadConfig(path string) (*Config, error) {
 
 	return &config, nil
 }
+
+// validHealthCheckType проверяет тип проверки здоровья; пустой тип означает значение по умолчанию
+func validHealthCheckType(checkType string) bool {
+	switch checkType {
+	case "", "http", "tcp", "grpc":
+		return true
+	default:
+		return false
+	}
+}
+
+// validRateLimitAlgorithm проверяет алгоритм ограничения частоты запросов
+func validRateLimitAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case "token-bucket", "fixed-window", "sliding-window", "sliding-log", "gcra", "leaky-bucket":
+		return true
+	default:
+		return false
+	}
+}
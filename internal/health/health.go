@@ -0,0 +1,112 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout максимальное время выполнения всех проверок готовности
+const checkTimeout = 2 * time.Second
+
+// CheckFunc проверка готовности; ошибка означает, что балансировщик не готов принимать запросы
+type CheckFunc func(ctx context.Context) error
+
+// CheckResult результат отдельной проверки
+type CheckResult struct {
+	Status string `json:"status"` // "ok" или "fail"
+	Error  string `json:"error,omitempty"`
+}
+
+// Response структура ответа эндпоинтов liveness и readiness
+type Response struct {
+	Status string                 `json:"status"` // "ok" или "fail"
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Checker выполняет проверки готовности балансировщика
+type Checker struct {
+	names  []string
+	checks map[string]CheckFunc
+	mutex  sync.RWMutex
+}
+
+// NewChecker создает пустой набор проверок
+func NewChecker() *Checker {
+	return &Checker{
+		checks: make(map[string]CheckFunc),
+	}
+}
+
+// AddCheck добавляет проверку готовности с указанным именем
+func (c *Checker) AddCheck(name string, check CheckFunc) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, exists := c.checks[name]; !exists {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Run выполняет все проверки параллельно и возвращает результат
+func (c *Checker) Run(ctx context.Context) Response {
+	c.mutex.RLock()
+	names := append([]string(nil), c.names...)
+	checks := make([]CheckFunc, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check CheckFunc) {
+			defer wg.Done()
+			errs[i] = check(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	response := Response{Status: "ok", Checks: make(map[string]CheckResult, len(names))}
+	for i, name := range names {
+		if errs[i] != nil {
+			response.Status = "fail"
+			response.Checks[name] = CheckResult{Status: "fail", Error: errs[i].Error()}
+			continue
+		}
+		response.Checks[name] = CheckResult{Status: "ok"}
+	}
+	return response
+}
+
+// LivenessHandler отвечает 200, пока процесс способен обрабатывать запросы
+func (c *Checker) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	sendResponse(w, http.StatusOK, Response{Status: "ok"})
+}
+
+// ReadinessHandler отвечает 200, если все проверки готовности пройдены, и 503 в противном случае
+func (c *Checker) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	response := c.Run(r.Context())
+
+	statusCode := http.StatusOK
+	if response.Status != "ok" {
+		statusCode = http.StatusServiceUnavailable
+	}
+	sendResponse(w, statusCode, response)
+}
+
+// sendResponse отправляет JSON-ответ с результатами проверок
+func sendResponse(w http.ResponseWriter, statusCode int, response Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,45 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	checker := NewChecker()
+	ready := true
+	checker.AddCheck("storage", func(ctx context.Context) error { return nil })
+	checker.AddCheck("backends", func(ctx context.Context) error {
+		if !ready {
+			return errors.New("0 of 2 backends available, at least 1 required")
+		}
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	checker.ReadinessHandler(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	ready = false
+	rec = httptest.NewRecorder()
+	checker.ReadinessHandler(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var response Response
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Equal(t, "fail", response.Status)
+	assert.Equal(t, CheckResult{Status: "ok"}, response.Checks["storage"])
+	assert.Equal(t, CheckResult{Status: "fail", Error: "0 of 2 backends available, at least 1 required"}, response.Checks["backends"])
+
+	// Liveness не зависит от проверок готовности
+	rec = httptest.NewRecorder()
+	checker.LivenessHandler(rec, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
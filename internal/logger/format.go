@@ -0,0 +1,132 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// textTimeLayout формат времени в текстовом формате, как у стандартного log
+const textTimeLayout = "2006/01/02 15:04:05"
+
+// formatText форматирует запись в виде "LEVEL 2006/01/02 15:04:05 сообщение key=value"
+func formatText(now time.Time, level LogLevel, msg string, fields []interface{}, colors bool) []byte {
+	var b strings.Builder
+
+	name := strings.ToUpper(level.String())
+	if colors {
+		b.WriteString(levelColors[level])
+		b.WriteString(name)
+		b.WriteString("\033[0m")
+	} else {
+		b.WriteString(name)
+	}
+	b.WriteString(strings.Repeat(" ", 6-len(name)))
+	b.WriteString(now.Format(textTimeLayout))
+	b.WriteByte(' ')
+	b.WriteString(msg)
+
+	forEachField(fields, func(key string, value interface{}) {
+		b.WriteByte(' ')
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(value))
+	})
+
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+// formatLogfmt форматирует запись в формате logfmt
+func formatLogfmt(now time.Time, level LogLevel, msg string, fields []interface{}) []byte {
+	var b strings.Builder
+
+	b.WriteString("time=")
+	b.WriteString(now.Format(time.RFC3339Nano))
+	b.WriteString(" level=")
+	b.WriteString(level.String())
+	b.WriteString(" msg=")
+	b.WriteString(logfmtValue(msg))
+
+	forEachField(fields, func(key string, value interface{}) {
+		b.WriteByte(' ')
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(value))
+	})
+
+	b.WriteByte('\n')
+	return []byte(b.String())
+}
+
+// formatJSON форматирует запись как JSON-объект в одну строку
+func formatJSON(now time.Time, level LogLevel, msg string, fields []interface{}) []byte {
+	var b strings.Builder
+
+	b.WriteString(`{"time":`)
+	b.WriteString(strconv.Quote(now.Format(time.RFC3339Nano)))
+	b.WriteString(`,"level":`)
+	b.WriteString(strconv.Quote(level.String()))
+	b.WriteString(`,"msg":`)
+	b.Write(jsonValue(msg))
+
+	forEachField(fields, func(key string, value interface{}) {
+		b.WriteByte(',')
+		b.Write(jsonValue(key))
+		b.WriteByte(':')
+		b.Write(jsonValue(value))
+	})
+
+	b.WriteString("}\n")
+	return []byte(b.String())
+}
+
+// forEachField перебирает пары ключ-значение. Ключ без значения записывается
+// с пустым значением, чтобы ошибка в вызове не теряла данные
+func forEachField(fields []interface{}, fn func(key string, value interface{})) {
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		var value interface{}
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		fn(key, value)
+	}
+}
+
+// plainValue приводит значение к виду, пригодному для записи
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// jsonValue кодирует значение в JSON; неподдерживаемые значения записываются строкой
+func jsonValue(value interface{}) []byte {
+	data, err := json.Marshal(plainValue(value))
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return data
+}
+
+// logfmtValue форматирует значение для logfmt, заключая его в кавычки при необходимости
+func logfmtValue(value interface{}) string {
+	s := fmt.Sprint(plainValue(value))
+	if value == nil {
+		s = ""
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\t\n\r") {
+		return strconv.Quote(s)
+	}
+	return s
+}
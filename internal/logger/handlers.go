@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// LevelRequest структура для запроса изменения уровня логирования
+type LevelRequest struct {
+	Level string `json:"level"`
+}
+
+// LevelResponse структура для ответа с текущим уровнем логирования
+type LevelResponse struct {
+	Level   string `json:"level"`
+	Message string `json:"message,omitempty"`
+}
+
+// errorResponse структура для ответа с ошибкой
+type errorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// GetLevelHandler обрабатывает запросы на получение уровня логирования
+func (l *Logger) GetLevelHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LevelResponse{Level: l.Level().String()})
+}
+
+// SetLevelHandler обрабатывает запросы на изменение уровня логирования
+func (l *Logger) SetLevelHandler(w http.ResponseWriter, r *http.Request) {
+	var req LevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	level, err := ParseLevel(req.Level)
+	if err != nil || level == FatalLevel {
+		sendErrorResponse(w, http.StatusBadRequest, "level must be one of debug, info, warn, error")
+		return
+	}
+
+	old := l.Level()
+	l.SetLevel(level)
+	l.Infow("Уровень логирования изменен", "from", old, "to", level)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LevelResponse{
+		Level:   level.String(),
+		Message: "Log level updated successfully",
+	})
+}
+
+// RegisterRoutes регистрирует маршруты API для управления уровнем логирования
+func (l *Logger) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/log-level", l.GetLevelHandler).Methods("GET")
+	router.HandleFunc("/log-level", l.SetLevelHandler).Methods("PUT")
+}
+
+// sendErrorResponse отправляет структурированный JSON-ответ с ошибкой
+func sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(errorResponse{
+		Code:    statusCode,
+		Message: message,
+	})
+}
@@ -1,9 +1,13 @@
 package logger
 
 import (
+	"fmt"
 	"io"
-	"log"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // LogLevel определяет уровень логирования
@@ -17,14 +21,75 @@ const (
 	FatalLevel
 )
 
+// levelNames названия уровней для форматов text, json и logfmt
+var levelNames = map[LogLevel]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+	FatalLevel: "fatal",
+}
+
+// levelColors цвета уровней в текстовом формате
+var levelColors = map[LogLevel]string{
+	DebugLevel: "\033[36m",
+	InfoLevel:  "\033[32m",
+	WarnLevel:  "\033[33m",
+	ErrorLevel: "\033[31m",
+	FatalLevel: "\033[35m",
+}
+
+// String возвращает название уровня
+func (l LogLevel) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel разбирает название уровня логирования
+func ParseLevel(name string) (LogLevel, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	if strings.EqualFold(name, "warning") {
+		return WarnLevel, nil
+	}
+	return InfoLevel, fmt.Errorf("неизвестный уровень логирования: %s", name)
+}
+
+// Format определяет формат записей лога
+type Format string
+
+const (
+	TextFormat   Format = "text"
+	JSONFormat   Format = "json"
+	LogfmtFormat Format = "logfmt"
+)
+
+// Options содержит настройки логгера
+type Options struct {
+	Level  LogLevel
+	Format Format
+	Colors bool // Раскрашивать уровень в текстовом формате
+	Output io.Writer
+}
+
+// core общее состояние логгера и его дочерних логгеров
+type core struct {
+	level  atomic.Int32
+	format Format
+	colors bool
+	output io.Writer
+	mutex  sync.Mutex // Записи разных горутин не перемешиваются
+}
+
 // Logger предоставляет интерфейс для логирования
 type Logger struct {
-	debug *log.Logger
-	info  *log.Logger
-	warn  *log.Logger
-	error *log.Logger
-	fatal *log.Logger
-	level LogLevel
+	core   *core
+	fields []interface{} // Пары ключ-значение, добавляемые к каждой записи
 }
 
 // NewLogger создает новый логгер с настройками по умолчанию
@@ -34,87 +99,178 @@ func NewLogger() *Logger {
 
 // NewLoggerWithLevel создает новый логгер с указанным уровнем и выводом
 func NewLoggerWithLevel(level LogLevel, output io.Writer) *Logger {
-	flags := log.Ldate | log.Ltime
+	return NewLoggerWithOptions(Options{
+		Level:  level,
+		Format: TextFormat,
+		Colors: true,
+		Output: output,
+	})
+}
+
+// NewLoggerWithOptions создает новый логгер с указанными настройками
+func NewLoggerWithOptions(opts Options) *Logger {
+	if opts.Format == "" {
+		opts.Format = TextFormat
+	}
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
 
-	return &Logger{
-		debug: log.New(output, "\033[36mDEBUG\033[0m ", flags),
-		info:  log.New(output, "\033[32mINFO\033[0m  ", flags),
-		warn:  log.New(output, "\033[33mWARN\033[0m  ", flags),
-		error: log.New(output, "\033[31mERROR\033[0m ", flags),
-		fatal: log.New(output, "\033[35mFATAL\033[0m ", flags),
-		level: level,
+	c := &core{
+		format: opts.Format,
+		colors: opts.Colors,
+		output: opts.Output,
 	}
+	c.level.Store(int32(opts.Level))
+
+	return &Logger{core: c}
+}
+
+// With возвращает логгер, добавляющий к каждой записи указанные пары ключ-значение.
+// Уровень логирования у него общий с исходным
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keysAndValues...)
+	return &Logger{core: l.core, fields: fields}
 }
 
 // Debugf записывает debug сообщение с форматированием
 func (l *Logger) Debugf(format string, args ...interface{}) {
-	if l.level <= DebugLevel {
-		l.debug.Printf(format, args...)
+	if l.Enabled(DebugLevel) {
+		l.write(DebugLevel, fmt.Sprintf(format, args...), nil)
 	}
 }
 
 // Debug записывает debug сообщение
 func (l *Logger) Debug(args ...interface{}) {
-	if l.level <= DebugLevel {
-		l.debug.Println(args...)
+	if l.Enabled(DebugLevel) {
+		l.write(DebugLevel, sprint(args...), nil)
+	}
+}
+
+// Debugw записывает debug сообщение с парами ключ-значение
+func (l *Logger) Debugw(msg string, keysAndValues ...interface{}) {
+	if l.Enabled(DebugLevel) {
+		l.write(DebugLevel, msg, keysAndValues)
 	}
 }
 
 // Infof записывает info сообщение с форматированием
 func (l *Logger) Infof(format string, args ...interface{}) {
-	if l.level <= InfoLevel {
-		l.info.Printf(format, args...)
+	if l.Enabled(InfoLevel) {
+		l.write(InfoLevel, fmt.Sprintf(format, args...), nil)
 	}
 }
 
 // Info записывает info сообщение
 func (l *Logger) Info(args ...interface{}) {
-	if l.level <= InfoLevel {
-		l.info.Println(args...)
+	if l.Enabled(InfoLevel) {
+		l.write(InfoLevel, sprint(args...), nil)
+	}
+}
+
+// Infow записывает info сообщение с парами ключ-значение
+func (l *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	if l.Enabled(InfoLevel) {
+		l.write(InfoLevel, msg, keysAndValues)
 	}
 }
 
 // Warnf записывает warning сообщение с форматированием
 func (l *Logger) Warnf(format string, args ...interface{}) {
-	if l.level <= WarnLevel {
-		l.warn.Printf(format, args...)
+	if l.Enabled(WarnLevel) {
+		l.write(WarnLevel, fmt.Sprintf(format, args...), nil)
 	}
 }
 
 // Warn записывает warning сообщение
 func (l *Logger) Warn(args ...interface{}) {
-	if l.level <= WarnLevel {
-		l.warn.Println(args...)
+	if l.Enabled(WarnLevel) {
+		l.write(WarnLevel, sprint(args...), nil)
+	}
+}
+
+// Warnw записывает warning сообщение с парами ключ-значение
+func (l *Logger) Warnw(msg string, keysAndValues ...interface{}) {
+	if l.Enabled(WarnLevel) {
+		l.write(WarnLevel, msg, keysAndValues)
 	}
 }
 
 // Errorf записывает error сообщение с форматированием
 func (l *Logger) Errorf(format string, args ...interface{}) {
-	if l.level <= ErrorLevel {
-		l.error.Printf(format, args...)
+	if l.Enabled(ErrorLevel) {
+		l.write(ErrorLevel, fmt.Sprintf(format, args...), nil)
 	}
 }
 
 // Error записывает error сообщение
 func (l *Logger) Error(args ...interface{}) {
-	if l.level <= ErrorLevel {
-		l.error.Println(args...)
+	if l.Enabled(ErrorLevel) {
+		l.write(ErrorLevel, sprint(args...), nil)
+	}
+}
+
+// Errorw записывает error сообщение с парами ключ-значение
+func (l *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	if l.Enabled(ErrorLevel) {
+		l.write(ErrorLevel, msg, keysAndValues)
 	}
 }
 
 // Fatalf записывает fatal сообщение с форматированием и завершает программу
 func (l *Logger) Fatalf(format string, args ...interface{}) {
-	l.fatal.Printf(format, args...)
+	l.write(FatalLevel, fmt.Sprintf(format, args...), nil)
 	os.Exit(1)
 }
 
 // Fatal записывает fatal сообщение и завершает программу
 func (l *Logger) Fatal(args ...interface{}) {
-	l.fatal.Println(args...)
+	l.write(FatalLevel, sprint(args...), nil)
 	os.Exit(1)
 }
 
-// SetLevel устанавливает уровень логирования
+// SetLevel устанавливает уровень логирования; безопасно вызывать во время работы
 func (l *Logger) SetLevel(level LogLevel) {
-	l.level = level
+	l.core.level.Store(int32(level))
+}
+
+// Level возвращает текущий уровень логирования
+func (l *Logger) Level() LogLevel {
+	return LogLevel(l.core.level.Load())
+}
+
+// Enabled сообщает, будут ли записаны сообщения указанного уровня
+func (l *Logger) Enabled(level LogLevel) bool {
+	return level >= l.Level()
+}
+
+// write форматирует и записывает одну запись лога
+func (l *Logger) write(level LogLevel, msg string, keysAndValues []interface{}) {
+	fields := l.fields
+	if len(keysAndValues) > 0 {
+		fields = append(fields[:len(fields):len(fields)], keysAndValues...)
+	}
+
+	var line []byte
+	now := time.Now()
+	switch l.core.format {
+	case JSONFormat:
+		line = formatJSON(now, level, msg, fields)
+	case LogfmtFormat:
+		line = formatLogfmt(now, level, msg, fields)
+	default:
+		line = formatText(now, level, msg, fields, l.core.colors)
+	}
+
+	l.core.mutex.Lock()
+	defer l.core.mutex.Unlock()
+	l.core.output.Write(line)
+}
+
+// sprint объединяет аргументы как fmt.Println, но без перевода строки
+func sprint(args ...interface{}) string {
+	msg := fmt.Sprintln(args...)
+	return msg[:len(msg)-1]
 }
@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewLoggerWithOptions(Options{Level: InfoLevel, Format: JSONFormat, Output: &buf}).With("component", "balancer")
+
+	log.Debugw("не попадет в лог")
+	log.Warnw("Сервер помечен как недоступный", "backend", "backend1:80", "failures", 3, "error", errors.New("timeout"))
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "warn", entry["level"])
+	assert.Equal(t, "Сервер помечен как недоступный", entry["msg"])
+	assert.Equal(t, "balancer", entry["component"])
+	assert.Equal(t, "backend1:80", entry["backend"])
+	assert.Equal(t, float64(3), entry["failures"])
+	assert.Equal(t, "timeout", entry["error"])
+}
+
+func TestLogfmtAndTextFormats(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewLoggerWithOptions(Options{Level: DebugLevel, Format: LogfmtFormat, Output: &buf})
+	log.Infow("Запрос перенаправлен", "path", "/a b", "latency", 1500*time.Millisecond)
+	assert.Regexp(t, `^time=\S+ level=info msg="Запрос перенаправлен" path="/a b" latency=1.5s\n$`, buf.String())
+
+	buf.Reset()
+	log = NewLoggerWithOptions(Options{Level: DebugLevel, Format: TextFormat, Output: &buf})
+	log.Errorf("Ошибка %d", 42)
+	assert.Regexp(t, `^ERROR \d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} Ошибка 42\n$`, buf.String())
+}
+
+func TestLevelHandler(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewLoggerWithOptions(Options{Level: InfoLevel, Output: &buf})
+	child := log.With("component", "ratelimiter")
+
+	router := mux.NewRouter()
+	log.RegisterRoutes(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("PUT", "/log-level", strings.NewReader(`{"level": "debug"}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// Уровень общий у логгера и дочерних логгеров
+	assert.Equal(t, DebugLevel, child.Level())
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("PUT", "/log-level", strings.NewReader(`{"level": "verbose"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/log-level", nil))
+	assert.JSONEq(t, `{"level": "debug"}`, rec.Body.String())
+}
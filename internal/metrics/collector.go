@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"load-balancer/internal/balancer"
+)
+
+// backendCollector считывает состояние серверов пула в момент сбора метрик,
+// поэтому добавленные и удаленные бэкенды сразу отражаются в метриках
+type backendCollector struct {
+	lb        *balancer.LoadBalancer
+	inFlight  *prometheus.Desc
+	healthy   *prometheus.Desc
+	available *prometheus.Desc
+}
+
+// newBackendCollector создает коллектор состояния серверов
+func newBackendCollector(lb *balancer.LoadBalancer) *backendCollector {
+	return &backendCollector{
+		lb: lb,
+		inFlight: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "backend", "in_flight_requests"),
+			"Запросы, обрабатываемые бэкендом.",
+			[]string{"backend"}, nil,
+		),
+		healthy: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "backend", "healthy"),
+			"Результат активной проверки здоровья бэкенда (1 - здоров).",
+			[]string{"backend"}, nil,
+		),
+		available: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "backend", "available"),
+			"Получает ли бэкенд запросы с учетом проверок, outlier detection, circuit breaker и состояния в API (1 - да).",
+			[]string{"backend"}, nil,
+		),
+	}
+}
+
+// Describe реализует prometheus.Collector
+func (c *backendCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.inFlight
+	ch <- c.healthy
+	ch <- c.available
+}
+
+// Collect реализует prometheus.Collector
+func (c *backendCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, server := range c.lb.Servers() {
+		backend := server.URL.Host
+		ch <- prometheus.MustNewConstMetric(c.inFlight, prometheus.GaugeValue, float64(server.ActiveConnections()), backend)
+		ch <- prometheus.MustNewConstMetric(c.healthy, prometheus.GaugeValue, boolValue(server.IsHealthy()), backend)
+		ch <- prometheus.MustNewConstMetric(c.available, prometheus.GaugeValue, boolValue(server.IsAvailable()), backend)
+	}
+}
+
+// boolValue переводит флаг в значение метрики
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
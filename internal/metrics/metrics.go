@@ -0,0 +1,214 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"load-balancer/internal/balancer"
+	"load-balancer/pkg/ratelimiter"
+)
+
+// namespace общий префикс имен метрик
+const namespace = "loadbalancer"
+
+// otherLabel метка для клиентов сверх лимита и нестандартных HTTP-методов
+const otherLabel = "other"
+
+// Metrics собирает метрики балансировщика, rate limiter и хранилища в формате Prometheus
+type Metrics struct {
+	registry *prometheus.Registry
+
+	upstreamRequests  *prometheus.CounterVec
+	upstreamLatency   *prometheus.HistogramVec
+	healthTransitions *prometheus.CounterVec
+	retries           *prometheus.CounterVec
+	proxyErrors       *prometheus.CounterVec
+	rateLimitDecision *prometheus.CounterVec
+	storageLatency    *prometheus.HistogramVec
+	storageErrors     *prometheus.CounterVec
+
+	clients *clientLabels
+}
+
+// New создает набор метрик. maxClients ограничивает число клиентов с отдельной
+// меткой, чтобы случайные IP-адреса не раздували количество временных рядов
+func New(maxClients int) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		upstreamRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "upstream_requests_total",
+			Help:      "Запросы к бэкендам по бэкенду, коду ответа и методу.",
+		}, []string{"backend", "code", "method"}),
+		upstreamLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upstream_request_duration_seconds",
+			Help:      "Время ответа бэкенда.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"backend"}),
+		healthTransitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "backend_health_transitions_total",
+			Help:      "Смены состояния бэкенда по результатам активной проверки.",
+		}, []string{"backend", "state"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retries_total",
+			Help:      "Повторы запросов по бэкенду, на котором попытка не удалась.",
+		}, []string{"backend"}),
+		proxyErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "proxy_errors_total",
+			Help:      "Ошибки проксирования по бэкенду и причине.",
+		}, []string{"backend", "reason"}),
+		rateLimitDecision: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ratelimit_decisions_total",
+			Help:      "Решения rate limiter по клиенту.",
+		}, []string{"client", "decision"}),
+		storageLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Время операций с хранилищем.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_errors_total",
+			Help:      "Ошибки операций с хранилищем.",
+		}, []string{"operation"}),
+		clients: newClientLabels(maxClients),
+	}
+
+	m.registry.MustRegister(
+		m.upstreamRequests,
+		m.upstreamLatency,
+		m.healthTransitions,
+		m.retries,
+		m.proxyErrors,
+		m.rateLimitDecision,
+		m.storageLatency,
+		m.storageErrors,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// Handler возвращает обработчик эндпоинта метрик
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterBalancer добавляет метрики состояния серверов пула, считываемые при каждом сборе
+func (m *Metrics) RegisterBalancer(lb *balancer.LoadBalancer) {
+	m.registry.MustRegister(newBackendCollector(lb))
+}
+
+// RegisterRateLimiter добавляет метрику количества ведер токенов
+func (m *Metrics) RegisterRateLimiter(limiter *ratelimiter.RateLimiter) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ratelimit_buckets",
+		Help:      "Количество ведер токенов в памяти.",
+	}, func() float64 {
+		return float64(limiter.BucketCount())
+	}))
+}
+
+// ObserveUpstream учитывает ответ бэкенда
+func (m *Metrics) ObserveUpstream(backend, method string, statusCode int, latency time.Duration) {
+	m.upstreamRequests.WithLabelValues(backend, strconv.Itoa(statusCode), methodLabel(method)).Inc()
+	m.upstreamLatency.WithLabelValues(backend).Observe(latency.Seconds())
+}
+
+// IncRetry учитывает повтор запроса после неудачной попытки на бэкенде
+func (m *Metrics) IncRetry(backend string) {
+	m.retries.WithLabelValues(backend).Inc()
+}
+
+// IncProxyError учитывает ошибку проксирования
+func (m *Metrics) IncProxyError(backend, reason string) {
+	m.proxyErrors.WithLabelValues(backend, reason).Inc()
+}
+
+// ObserveHealthTransition учитывает смену состояния бэкенда
+func (m *Metrics) ObserveHealthTransition(backend string, healthy bool) {
+	state := "unhealthy"
+	if healthy {
+		state = "healthy"
+	}
+	m.healthTransitions.WithLabelValues(backend, state).Inc()
+}
+
+// ObserveDecision учитывает решение rate limiter
+func (m *Metrics) ObserveDecision(clientID string, allowed bool) {
+	decision := "denied"
+	if allowed {
+		decision = "allowed"
+	}
+	m.rateLimitDecision.WithLabelValues(m.clients.label(clientID), decision).Inc()
+}
+
+// observeStorage учитывает операцию с хранилищем
+func (m *Metrics) observeStorage(operation string, start time.Time, err error) {
+	m.storageLatency.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.storageErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// methodLabel возвращает метку HTTP-метода; нестандартные методы объединяются
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return otherLabel
+	}
+}
+
+// clientLabels выдает отдельные метки первым maxClients клиентам, остальным - "other"
+type clientLabels struct {
+	max   int
+	seen  map[string]struct{}
+	mutex sync.RWMutex
+}
+
+// newClientLabels создает ограниченный набор меток клиентов
+func newClientLabels(max int) *clientLabels {
+	return &clientLabels{
+		max:  max,
+		seen: make(map[string]struct{}),
+	}
+}
+
+// label возвращает метку для клиента
+func (c *clientLabels) label(clientID string) string {
+	c.mutex.RLock()
+	_, known := c.seen[clientID]
+	c.mutex.RUnlock()
+	if known {
+		return clientID
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, known := c.seen[clientID]; known {
+		return clientID
+	}
+	if len(c.seen) >= c.max {
+		return otherLabel
+	}
+	c.seen[clientID] = struct{}{}
+	return clientID
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"load-balancer/internal/balancer"
+	"load-balancer/internal/config"
+	"load-balancer/internal/logger"
+	"load-balancer/pkg/storage"
+)
+
+// scrape возвращает метрики в текстовом формате Prometheus
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestBalancerMetrics(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer backend.Close()
+	host := strings.TrimPrefix(backend.URL, "http://")
+
+	lb, err := balancer.NewLoadBalancer(
+		[]config.BackendConfig{{URL: backend.URL, Weight: 1}},
+		config.BalancerConfig{Algorithm: "round-robin"},
+		logger.NewLoggerWithLevel(logger.FatalLevel, io.Discard),
+	)
+	require.NoError(t, err)
+
+	m := New(10)
+	lb.SetMetrics(m)
+	m.RegisterBalancer(lb)
+
+	lb.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	m.ObserveHealthTransition(host, false)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `loadbalancer_upstream_requests_total{backend="`+host+`",code="418",method="GET"} 1`)
+	assert.Contains(t, body, `loadbalancer_upstream_request_duration_seconds_count{backend="`+host+`"} 1`)
+	assert.Contains(t, body, `loadbalancer_backend_in_flight_requests{backend="`+host+`"} 0`)
+	assert.Contains(t, body, `loadbalancer_backend_healthy{backend="`+host+`"} 1`)
+	assert.Contains(t, body, `loadbalancer_backend_health_transitions_total{backend="`+host+`",state="unhealthy"} 1`)
+}
+
+func TestRateLimitClientCardinality(t *testing.T) {
+	m := New(2)
+	m.ObserveDecision("a", true)
+	m.ObserveDecision("b", false)
+	m.ObserveDecision("c", true)
+	m.ObserveDecision("d", true)
+	m.ObserveDecision("a", true)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `loadbalancer_ratelimit_decisions_total{client="a",decision="allowed"} 2`)
+	assert.Contains(t, body, `loadbalancer_ratelimit_decisions_total{client="b",decision="denied"} 1`)
+	assert.Contains(t, body, `loadbalancer_ratelimit_decisions_total{client="other",decision="allowed"} 2`)
+}
+
+func TestStorageMetrics(t *testing.T) {
+	m := New(10)
+	store := m.InstrumentStorage(failingStorage{})
+
+	_, err := store.LoadAllBackends()
+	require.Error(t, err)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `loadbalancer_storage_errors_total{operation="load_all_backends"} 1`)
+	assert.Contains(t, body, `loadbalancer_storage_operation_duration_seconds_count{operation="load_all_backends"} 1`)
+
+	tokens := m.InstrumentTokenStore(failingStorage{})
+	_, _, err = tokens.TakeTokens(context.Background(), "client", 10, 1, 1)
+	require.Error(t, err)
+	assert.Contains(t, scrape(t, m), `loadbalancer_storage_errors_total{operation="take_tokens"} 1`)
+}
+
+// failingStorage хранилище, загрузка бэкендов и списание токенов в котором
+// всегда завершаются ошибкой
+type failingStorage struct {
+	storage.Storage
+}
+
+func (failingStorage) TakeTokens(ctx context.Context, key string, capacity int, refillRate float64, n int) (int, float64, error) {
+	return 0, 0, errors.New("connection refused")
+}
+
+func (failingStorage) LoadAllBackends() ([]storage.Backend, error) {
+	return nil, errors.New("connection refused")
+}
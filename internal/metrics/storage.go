@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"load-balancer/pkg/storage"
+)
+
+// instrumentedStorage измеряет время и ошибки операций с хранилищем
+type instrumentedStorage struct {
+	storage.Storage
+	metrics *Metrics
+}
+
+// InstrumentStorage возвращает хранилище, операции которого учитываются в метриках
+func (m *Metrics) InstrumentStorage(store storage.Storage) storage.Storage {
+	return &instrumentedStorage{Storage: store, metrics: m}
+}
+
+func (s *instrumentedStorage) SaveClientLimit(clientID string, limit storage.ClientLimit) error {
+	start := time.Now()
+	err := s.Storage.SaveClientLimit(clientID, limit)
+	s.metrics.observeStorage("save_client_limit", start, err)
+	return err
+}
+
+func (s *instrumentedStorage) GetClientLimit(clientID string) (storage.ClientLimit, bool, error) {
+	start := time.Now()
+	limit, exists, err := s.Storage.GetClientLimit(clientID)
+	s.metrics.observeStorage("get_client_limit", start, err)
+	return limit, exists, err
+}
+
+func (s *instrumentedStorage) LoadAllClientLimits() (map[string]storage.ClientLimit, error) {
+	start := time.Now()
+	limits, err := s.Storage.LoadAllClientLimits()
+	s.metrics.observeStorage("load_all_client_limits", start, err)
+	return limits, err
+}
+
+func (s *instrumentedStorage) DeleteClientLimit(clientID string) error {
+	start := time.Now()
+	err := s.Storage.DeleteClientLimit(clientID)
+	s.metrics.observeStorage("delete_client_limit", start, err)
+	return err
+}
+
+func (s *instrumentedStorage) SaveBackend(backend storage.Backend) error {
+	start := time.Now()
+	err := s.Storage.SaveBackend(backend)
+	s.metrics.observeStorage("save_backend", start, err)
+	return err
+}
+
+func (s *instrumentedStorage) LoadAllBackends() ([]storage.Backend, error) {
+	start := time.Now()
+	backends, err := s.Storage.LoadAllBackends()
+	s.metrics.observeStorage("load_all_backends", start, err)
+	return backends, err
+}
+
+func (s *instrumentedStorage) DeleteBackend(url string) error {
+	start := time.Now()
+	err := s.Storage.DeleteBackend(url)
+	s.metrics.observeStorage("delete_backend", start, err)
+	return err
+}
+
+func (s *instrumentedStorage) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := s.Storage.Ping(ctx)
+	s.metrics.observeStorage("ping", start, err)
+	return err
+}
+
+// instrumentedTokenStore измеряет время и ошибки обращений к общим ведрам токенов
+type instrumentedTokenStore struct {
+	storage.TokenStore
+	metrics *Metrics
+}
+
+// InstrumentTokenStore возвращает хранилище ведер, обращения к которому учитываются в метриках
+func (m *Metrics) InstrumentTokenStore(store storage.TokenStore) storage.TokenStore {
+	return &instrumentedTokenStore{TokenStore: store, metrics: m}
+}
+
+func (s *instrumentedTokenStore) TakeTokens(ctx context.Context, key string, capacity int, refillRate float64, n int) (int, float64, error) {
+	start := time.Now()
+	taken, remaining, err := s.TokenStore.TakeTokens(ctx, key, capacity, refillRate, n)
+	s.metrics.observeStorage("take_tokens", start, err)
+	return taken, remaining, err
+}
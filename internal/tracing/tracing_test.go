@@ -0,0 +1,111 @@
+package tracing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"load-balancer/internal/balancer"
+	"load-balancer/internal/config"
+	"load-balancer/internal/logger"
+)
+
+func TestTraceContextPropagation(t *testing.T) {
+	_, err := Setup(config.TracingConfig{})
+	require.NoError(t, err)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(sdktrace.NewTracerProvider()) })
+
+	var traceparent string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	lb, err := balancer.NewLoadBalancer(
+		[]config.BackendConfig{{URL: backend.URL, Weight: 1}},
+		config.BalancerConfig{Algorithm: "round-robin"},
+		logger.NewLoggerWithLevel(logger.FatalLevel, io.Discard),
+	)
+	require.NoError(t, err)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	Middleware(lb).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		name := span.Name()
+		if strings.HasPrefix(name, "proxy ") {
+			name = "proxy"
+		}
+		spans[name] = span
+		assert.Equal(t, traceID, span.SpanContext().TraceID().String(), name)
+	}
+	require.Contains(t, spans, "HTTP GET")
+	require.Contains(t, spans, "select backend")
+	require.Contains(t, spans, "proxy")
+
+	server := spans["HTTP GET"]
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Equal(t, server.SpanContext().SpanID(), spans["proxy"].Parent().SpanID())
+	assert.Equal(t, server.SpanContext().SpanID(), spans["select backend"].Parent().SpanID())
+
+	// Бэкенд получает контекст спана запроса к нему, а не исходный traceparent клиента
+	proxySpan := spans["proxy"].SpanContext()
+	assert.Equal(t, "00-"+traceID+"-"+proxySpan.SpanID().String()+"-01", traceparent)
+	assert.Equal(t, "00-"+traceID+"-00f067aa0ba902b7-01", req.Header.Get("traceparent"), "входящий запрос не меняется")
+
+	// При повторе каждая попытка передает бэкенду контекст своего спана
+	var traceparents []string
+	newBackend := func(code int) *httptest.Server {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceparents = append(traceparents, r.Header.Get("traceparent"))
+			w.WriteHeader(code)
+		}))
+		t.Cleanup(backend.Close)
+		return backend
+	}
+	unavailable, ok := newBackend(http.StatusServiceUnavailable), newBackend(http.StatusOK)
+
+	lb, err = balancer.NewLoadBalancer(
+		[]config.BackendConfig{{URL: unavailable.URL, Weight: 1}, {URL: ok.URL, Weight: 1}},
+		config.BalancerConfig{Algorithm: "round-robin", Retry: config.RetryConfig{
+			MaxRetries: 1, MaxBodyBytes: 1024, BudgetRatio: 1, MinRetriesPerSecond: 10,
+		}},
+		logger.NewLoggerWithLevel(logger.FatalLevel, io.Discard),
+	)
+	require.NoError(t, err)
+
+	ended := len(recorder.Ended())
+	rec = httptest.NewRecorder()
+	Middleware(lb).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var proxySpans []string
+	for _, span := range recorder.Ended()[ended:] {
+		if strings.HasPrefix(span.Name(), "proxy ") {
+			proxySpans = append(proxySpans, span.SpanContext().SpanID().String())
+		}
+	}
+	require.Len(t, proxySpans, 2)
+	require.Len(t, traceparents, 2)
+	for i := range traceparents {
+		assert.Contains(t, traceparents[i], "-"+proxySpans[i]+"-", "попытка %d", i)
+	}
+}
@@ -0,0 +1,191 @@
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// contextKey ключ адреса клиента в контексте запроса
+type contextKey struct{}
+
+// client адрес клиента, определенный Middleware
+type client struct {
+	ip  string // Нормализованный IP-адрес
+	key string // Адрес, агрегированный по префиксу сети
+}
+
+// Options определяет, каким прокси можно доверять и как агрегировать адреса
+type Options struct {
+	TrustedProxies []*net.IPNet // Прокси, от которых принимаются X-Forwarded-For, X-Real-IP и Forwarded
+	IPv4Prefix     int          // Длина префикса для агрегации IPv4; 0 или 32 - без агрегации
+	IPv6Prefix     int          // Длина префикса для агрегации IPv6; 0 или 128 - без агрегации
+}
+
+// ParseNetworks разбирает список сетей в формате CIDR
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("неверная сеть %s: %w", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Middleware определяет адрес клиента и сохраняет его в контексте запроса
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := client{ip: r.RemoteAddr, key: r.RemoteAddr}
+			if ip := opts.Resolve(r); ip != nil {
+				c = client{ip: ip.String(), key: opts.aggregate(ip)}
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, c)))
+		})
+	}
+}
+
+// FromRequest возвращает IP-адрес клиента. Без Middleware это адрес соединения
+// без порта
+func FromRequest(r *http.Request) string {
+	if c, ok := r.Context().Value(contextKey{}).(client); ok {
+		return c.ip
+	}
+	return remoteAddr(r)
+}
+
+// KeyFromRequest возвращает адрес клиента, агрегированный по префиксу сети
+// (например, 203.0.113.0/24), или сам адрес, если агрегация не настроена
+func KeyFromRequest(r *http.Request) string {
+	if c, ok := r.Context().Value(contextKey{}).(client); ok {
+		return c.key
+	}
+	return remoteAddr(r)
+}
+
+// Resolve определяет IP-адрес клиента. Заголовки прокси учитываются, только если
+// соединение пришло от доверенного прокси: цепочка адресов просматривается справа
+// налево, и клиентом считается первый адрес не из доверенных сетей
+func (o Options) Resolve(r *http.Request) net.IP {
+	peer := PeerIP(r)
+	if peer == nil || !Contains(o.TrustedProxies, peer) {
+		return peer
+	}
+
+	// Адреса в порядке прохождения запроса, последний добавлен ближайшим прокси
+	var chain []string
+	switch {
+	case len(r.Header.Values("Forwarded")) > 0:
+		chain = forwardedFor(r.Header.Values("Forwarded"))
+	case len(r.Header.Values("X-Forwarded-For")) > 0:
+		chain = splitList(r.Header.Values("X-Forwarded-For"))
+	case r.Header.Get("X-Real-IP") != "":
+		chain = []string{r.Header.Get("X-Real-IP")}
+	}
+
+	ip := peer
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop := parseIP(chain[i])
+		if hop == nil {
+			// Доверенный прокси не смог указать адрес (unknown, скрытый идентификатор),
+			// дальше по цепочке верить нельзя
+			return ip
+		}
+		ip = hop
+		if !Contains(o.TrustedProxies, ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// PeerIP возвращает нормализованный адрес соединения без порта или nil, если
+// адрес не разобран. Заголовки прокси не учитываются
+func PeerIP(r *http.Request) net.IP {
+	return parseIP(r.RemoteAddr)
+}
+
+// Contains проверяет, входит ли адрес в одну из сетей
+func Contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregate возвращает сеть адреса с настроенной длиной префикса или сам адрес
+func (o Options) aggregate(ip net.IP) string {
+	bits, prefix := 128, o.IPv6Prefix
+	if ip.To4() != nil {
+		bits, prefix = 32, o.IPv4Prefix
+	}
+	if prefix <= 0 || prefix >= bits {
+		return ip.String()
+	}
+
+	network := net.IPNet{IP: ip.Mask(net.CIDRMask(prefix, bits)), Mask: net.CIDRMask(prefix, bits)}
+	return network.String()
+}
+
+// remoteAddr возвращает адрес соединения без порта; неразобранный адрес
+// возвращается как есть
+func remoteAddr(r *http.Request) string {
+	if ip := PeerIP(r); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// parseIP разбирает адрес с необязательным портом и зоной IPv6. IPv4-адреса,
+// отображенные в IPv6 (::ffff:192.0.2.1), приводятся к IPv4
+func parseIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if zone := strings.IndexByte(addr, '%'); zone >= 0 {
+		addr = addr[:zone]
+	}
+
+	ip := net.ParseIP(addr)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// splitList разбирает значения заголовка со списком через запятую
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+	}
+	return items
+}
+
+// forwardedFor извлекает параметры for из заголовка Forwarded (RFC 7239).
+// Элемент без for сохраняется пустым, чтобы разорвать цепочку доверия
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, element := range splitList(values) {
+		hop := ""
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				hop = strings.Trim(value, `"`)
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
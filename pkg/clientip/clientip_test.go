@@ -0,0 +1,73 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	proxies, err := ParseNetworks([]string{"10.0.0.0/8", "fd00::/8"})
+	require.NoError(t, err)
+	opts := Options{TrustedProxies: proxies}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"port stripped", "203.0.113.7:54321", nil, "203.0.113.7"},
+		{"ipv6 normalized", "[2001:DB8:0:0::1%eth0]:443", nil, "2001:db8::1"},
+		{"ipv4-mapped ipv6", "[::ffff:203.0.113.7]:443", nil, "203.0.113.7"},
+		{"untrusted peer ignores headers", "203.0.113.7:1", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"x-forwarded-for", "10.0.0.1:1", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"spoofed entry left of client", "10.0.0.1:1", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"all hops trusted", "10.0.0.1:1", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"unknown hop", "10.0.0.1:1", map[string]string{"X-Forwarded-For": "198.51.100.1, unknown"}, "10.0.0.1"},
+		{"x-real-ip", "10.0.0.1:1", map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1"},
+		{"forwarded", "[fd00::1]:1", map[string]string{"Forwarded": `for=198.51.100.1;proto=https, for="[2001:db8::2]:4711"`}, "2001:db8::2"},
+		{"forwarded over x-forwarded-for", "10.0.0.1:1", map[string]string{"Forwarded": "for=198.51.100.1", "X-Forwarded-For": "198.51.100.2"}, "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			assert.Equal(t, tt.want, opts.Resolve(req).String())
+		})
+	}
+}
+
+func TestMiddlewareAggregation(t *testing.T) {
+	var ip, key string
+	handler := Middleware(Options{IPv4Prefix: 24, IPv6Prefix: 64})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip = FromRequest(r)
+			key = KeyFromRequest(r)
+		}))
+
+	for remoteAddr, want := range map[string]string{
+		"203.0.113.7:1":          "203.0.113.0/24",
+		"[2001:db8::1:2:3]:1":    "2001:db8::/64",
+		"unparsable-remote-addr": "unparsable-remote-addr",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, want, key, remoteAddr)
+		assert.NotContains(t, ip, "/", remoteAddr)
+	}
+
+	// Без Middleware адрес берется из соединения
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:1"
+	assert.Equal(t, "203.0.113.7", FromRequest(req))
+	assert.Equal(t, "203.0.113.7", KeyFromRequest(req))
+}
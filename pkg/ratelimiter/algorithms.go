@@ -0,0 +1,478 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Названия алгоритмов ограничения
+const (
+	TokenBucketAlgorithm   = "token-bucket"   // Ведро токенов: всплеск до capacity, пополнение refill_rate в секунду
+	FixedWindowAlgorithm   = "fixed-window"   // Не больше capacity запросов в фиксированном окне
+	SlidingWindowAlgorithm = "sliding-window" // Счетчик скользящего окна: взвешенная сумма текущего и прошлого окна
+	SlidingLogAlgorithm    = "sliding-log"    // Журнал времени запросов за последнее окно
+	GCRAAlgorithm          = "gcra"           // Generic Cell Rate Algorithm: ведро токенов через теоретическое время прихода
+	LeakyBucketAlgorithm   = "leaky-bucket"   // Очередь до capacity запросов, выпускаемых равномерно с задержкой
+)
+
+// foreverWindow заменяет бесконечный интервал при нулевой скорости пополнения.
+// Произведения с ним ограничиваются mulDuration, а отсчитанное от него время
+// восстановления не попадает в заголовки (см. untilRecovery)
+const foreverWindow = 100 * 365 * 24 * time.Hour
+
+// Algorithm состояние алгоритма ограничения одного клиента. Все алгоритмы
+// настраиваются емкостью и скоростью: оконные алгоритмы пропускают capacity
+// запросов за окно длиной capacity/refill_rate секунд. Методы вызываются под
+// мьютексом клиента
+type Algorithm interface {
+	// Allow решает, пропустить ли запрос, пришедший в момент now
+	Allow(now time.Time) Decision
+	// SetLimit меняет настройки, по возможности сохраняя накопленное состояние
+	SetLimit(capacity int, refillRate float64, now time.Time)
+}
+
+// algorithms конструкторы алгоритмов по названиям
+var algorithms = map[string]func(capacity int, refillRate float64, now time.Time) Algorithm{
+	TokenBucketAlgorithm: func(capacity int, refillRate float64, now time.Time) Algorithm {
+		return NewTokenBucket(capacity, refillRate, now)
+	},
+	FixedWindowAlgorithm: func(capacity int, refillRate float64, now time.Time) Algorithm {
+		return NewFixedWindow(capacity, refillRate)
+	},
+	SlidingWindowAlgorithm: func(capacity int, refillRate float64, now time.Time) Algorithm {
+		return NewSlidingWindow(capacity, refillRate)
+	},
+	SlidingLogAlgorithm: func(capacity int, refillRate float64, now time.Time) Algorithm {
+		return NewSlidingLog(capacity, refillRate)
+	},
+	GCRAAlgorithm: func(capacity int, refillRate float64, now time.Time) Algorithm {
+		return NewGCRA(capacity, refillRate)
+	},
+	LeakyBucketAlgorithm: func(capacity int, refillRate float64, now time.Time) Algorithm {
+		return NewLeakyBucket(capacity, refillRate)
+	},
+}
+
+// NewAlgorithm создает алгоритм по названию
+func NewAlgorithm(name string, capacity int, refillRate float64, now time.Time) (Algorithm, error) {
+	newAlgorithm, ok := algorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("неизвестный алгоритм ограничения: %s", name)
+	}
+	return newAlgorithm(capacity, refillRate, now), nil
+}
+
+// IsAlgorithm проверяет, поддерживается ли алгоритм
+func IsAlgorithm(name string) bool {
+	_, ok := algorithms[name]
+	return ok
+}
+
+// Algorithms возвращает названия поддерживаемых алгоритмов
+func Algorithms() []string {
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// windowFor возвращает длину окна, за которое восстанавливается capacity запросов
+func windowFor(capacity int, refillRate float64) time.Duration {
+	if refillRate <= 0 || capacity <= 0 {
+		return foreverWindow
+	}
+	return secondsDuration(float64(capacity) / refillRate)
+}
+
+// intervalFor возвращает интервал между запросами при равномерном потоке
+func intervalFor(refillRate float64) time.Duration {
+	if refillRate <= 0 {
+		return foreverWindow
+	}
+	return secondsDuration(1 / refillRate)
+}
+
+// secondsDuration переводит секунды в time.Duration без переполнения int64:
+// при очень низкой скорости результат не превышает foreverWindow
+func secondsDuration(seconds float64) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+	if seconds >= foreverWindow.Seconds() || math.IsNaN(seconds) {
+		return foreverWindow
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// mulDuration умножает интервал на n без переполнения int64: результат не
+// превышает foreverWindow
+func mulDuration(n int, d time.Duration) time.Duration {
+	if n <= 0 || d <= 0 {
+		return 0
+	}
+	if d >= foreverWindow/time.Duration(n) {
+		return foreverWindow
+	}
+	return time.Duration(n) * d
+}
+
+// untilRecovery возвращает время ожидания d, если лимит восстанавливается за
+// конечный период. При нулевой скорости period равен foreverWindow, и, как
+// TokenBucket, алгоритм не сообщает клиенту время ожидания
+func untilRecovery(d, period time.Duration) time.Duration {
+	if d <= 0 || period >= foreverWindow {
+		return 0
+	}
+	return d
+}
+
+// TokenBucket представляет ведро токенов для отдельного клиента
+type TokenBucket struct {
+	capacity   int       // Максимальное количество токенов
+	tokens     float64   // Текущее количество токенов, с накопленной долей следующего
+	refillRate float64   // Токенов в секунду
+	lastRefill time.Time // Время, на которое пересчитаны токены
+}
+
+// NewTokenBucket создает полное ведро
+func NewTokenBucket(capacity int, refillRate float64, now time.Time) *TokenBucket {
+	return &TokenBucket{
+		capacity:   capacity,
+		tokens:     float64(capacity),
+		refillRate: refillRate,
+		lastRefill: now,
+	}
+}
+
+// Allow списывает токен, если он есть
+func (b *TokenBucket) Allow(now time.Time) Decision {
+	b.refill(now)
+
+	decision := Decision{Limit: b.capacity}
+	if b.tokens >= 1 {
+		b.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = b.timeUntil(1)
+	}
+
+	decision.Remaining = int(b.tokens)
+	decision.Reset = b.timeUntil(float64(b.capacity))
+	return decision
+}
+
+// SetLimit меняет емкость и скорость; токены, накопленные по старой скорости,
+// начисляются до ее смены
+func (b *TokenBucket) SetLimit(capacity int, refillRate float64, now time.Time) {
+	b.refill(now)
+	b.capacity = capacity
+	b.refillRate = refillRate
+	if b.tokens > float64(capacity) {
+		b.tokens = float64(capacity)
+	}
+}
+
+// refill начисляет токены за время с прошлого пересчета, включая дробную часть,
+// поэтому низкие скорости (например, 0.5 токена в секунду) не теряют накопленное
+func (b *TokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	b.tokens += elapsed * b.refillRate
+	if b.tokens > float64(b.capacity) {
+		b.tokens = float64(b.capacity)
+	}
+	b.lastRefill = now
+}
+
+// timeUntil возвращает время, через которое в ведре будет tokens токенов;
+// вызывается сразу после refill
+func (b *TokenBucket) timeUntil(tokens float64) time.Duration {
+	missing := tokens - b.tokens
+	if missing <= 0 || b.refillRate <= 0 {
+		return 0
+	}
+	return untilRecovery(secondsDuration(missing/b.refillRate), windowFor(b.capacity, b.refillRate))
+}
+
+// FixedWindow считает запросы в окнах, выровненных по времени. На границе окон
+// возможен всплеск до 2*capacity запросов
+type FixedWindow struct {
+	limit  int
+	window time.Duration
+	start  time.Time // Начало текущего окна
+	count  int
+}
+
+// NewFixedWindow создает счетчик фиксированного окна
+func NewFixedWindow(capacity int, refillRate float64) *FixedWindow {
+	return &FixedWindow{limit: capacity, window: windowFor(capacity, refillRate)}
+}
+
+// Allow учитывает запрос в текущем окне
+func (w *FixedWindow) Allow(now time.Time) Decision {
+	if start := now.Truncate(w.window); start.After(w.start) {
+		w.start = start
+		w.count = 0
+	}
+
+	decision := Decision{Limit: w.limit, Reset: untilRecovery(w.start.Add(w.window).Sub(now), w.window)}
+	if w.count < w.limit {
+		w.count++
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = decision.Reset
+	}
+
+	decision.Remaining = w.limit - w.count
+	if decision.Remaining < 0 {
+		decision.Remaining = 0
+	}
+	return decision
+}
+
+// SetLimit меняет лимит; запросы текущего окна продолжают учитываться
+func (w *FixedWindow) SetLimit(capacity int, refillRate float64, now time.Time) {
+	w.limit = capacity
+	w.window = windowFor(capacity, refillRate)
+}
+
+// SlidingWindow приближает скользящее окно взвешенной суммой запросов текущего
+// и предыдущего фиксированных окон, храня только два счетчика
+type SlidingWindow struct {
+	limit  int
+	window time.Duration
+	start  time.Time // Начало текущего окна
+	prev   int       // Запросов в предыдущем окне
+	curr   int       // Запросов в текущем окне
+}
+
+// NewSlidingWindow создает счетчик скользящего окна
+func NewSlidingWindow(capacity int, refillRate float64) *SlidingWindow {
+	return &SlidingWindow{limit: capacity, window: windowFor(capacity, refillRate)}
+}
+
+// Allow учитывает запрос, если оценка числа запросов за последнее окно меньше лимита
+func (w *SlidingWindow) Allow(now time.Time) Decision {
+	w.advance(now)
+
+	estimate := w.estimate(now)
+	decision := Decision{Limit: w.limit}
+	if estimate+1 <= float64(w.limit) {
+		w.curr++
+		estimate++
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = untilRecovery(w.retryAfter(now), w.window)
+	}
+
+	decision.Remaining = int(math.Max(0, math.Floor(float64(w.limit)-estimate)))
+	switch {
+	case w.curr > 0:
+		decision.Reset = untilRecovery(w.start.Add(2*w.window).Sub(now), w.window)
+	case w.prev > 0:
+		decision.Reset = untilRecovery(w.start.Add(w.window).Sub(now), w.window)
+	}
+	return decision
+}
+
+// SetLimit меняет лимит; счетчики окон сохраняются
+func (w *SlidingWindow) SetLimit(capacity int, refillRate float64, now time.Time) {
+	w.limit = capacity
+	w.window = windowFor(capacity, refillRate)
+}
+
+// advance переходит к окну, содержащему now
+func (w *SlidingWindow) advance(now time.Time) {
+	start := now.Truncate(w.window)
+	if !start.After(w.start) {
+		return
+	}
+
+	if start.Sub(w.start) == w.window {
+		w.prev = w.curr
+	} else {
+		w.prev = 0
+	}
+	w.curr = 0
+	w.start = start
+}
+
+// estimate оценивает число запросов за окно, заканчивающееся в now
+func (w *SlidingWindow) estimate(now time.Time) float64 {
+	elapsed := float64(now.Sub(w.start)) / float64(w.window)
+	return float64(w.prev)*(1-elapsed) + float64(w.curr)
+}
+
+// retryAfter вычисляет, когда оценка опустится настолько, что запрос пройдет
+func (w *SlidingWindow) retryAfter(now time.Time) time.Duration {
+	allowed := float64(w.limit - 1) // Оценка, при которой запрос еще пропускается
+	if allowed < 0 {
+		return 0
+	}
+
+	// В текущем окне вес предыдущего убывает: prev*(1-f) + curr <= allowed
+	if float64(w.curr) <= allowed && w.prev > 0 {
+		f := 1 - (allowed-float64(w.curr))/float64(w.prev)
+		return w.start.Add(time.Duration(f * float64(w.window))).Sub(now)
+	}
+
+	// Иначе ждем следующего окна, где текущий счетчик станет предыдущим
+	f := 1 - allowed/float64(w.curr)
+	return w.start.Add(w.window + time.Duration(f*float64(w.window))).Sub(now)
+}
+
+// SlidingLog хранит время пропущенных запросов за последнее окно. Точнее
+// счетчиков, но занимает память пропорционально лимиту
+type SlidingLog struct {
+	limit  int
+	window time.Duration
+	log    []time.Time // Время пропущенных запросов по возрастанию
+}
+
+// NewSlidingLog создает журнал скользящего окна
+func NewSlidingLog(capacity int, refillRate float64) *SlidingLog {
+	return &SlidingLog{limit: capacity, window: windowFor(capacity, refillRate)}
+}
+
+// Allow пропускает запрос, если за последнее окно пропущено меньше limit запросов
+func (l *SlidingLog) Allow(now time.Time) Decision {
+	// Убираем запросы, вышедшие из окна
+	expired := 0
+	for expired < len(l.log) && !l.log[expired].After(now.Add(-l.window)) {
+		expired++
+	}
+	l.log = l.log[expired:]
+
+	decision := Decision{Limit: l.limit}
+	if len(l.log) < l.limit {
+		l.log = append(l.log, now)
+		decision.Allowed = true
+	} else if l.limit > 0 {
+		// Запрос пройдет, когда из окна выйдет limit-й с конца пропущенный запрос
+		decision.RetryAfter = untilRecovery(l.log[len(l.log)-l.limit].Add(l.window).Sub(now), l.window)
+	}
+
+	decision.Remaining = l.limit - len(l.log)
+	if decision.Remaining < 0 {
+		decision.Remaining = 0
+	}
+	if len(l.log) > 0 {
+		decision.Reset = untilRecovery(l.log[len(l.log)-1].Add(l.window).Sub(now), l.window)
+	}
+	return decision
+}
+
+// SetLimit меняет лимит; журнал сохраняется
+func (l *SlidingLog) SetLimit(capacity int, refillRate float64, now time.Time) {
+	l.limit = capacity
+	l.window = windowFor(capacity, refillRate)
+}
+
+// GCRA реализует Generic Cell Rate Algorithm: хранит только теоретическое время
+// прихода следующего запроса (TAT). Поведение совпадает с ведром токенов
+type GCRA struct {
+	limit    int
+	interval time.Duration // Интервал между запросами при равномерном потоке
+	tat      time.Time
+}
+
+// NewGCRA создает ограничитель GCRA
+func NewGCRA(capacity int, refillRate float64) *GCRA {
+	return &GCRA{limit: capacity, interval: intervalFor(refillRate)}
+}
+
+// Allow пропускает запрос, если он приходит не раньше TAT за вычетом допустимого всплеска
+func (g *GCRA) Allow(now time.Time) Decision {
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(g.interval)
+	burst := mulDuration(g.limit, g.interval)
+
+	decision := Decision{Limit: g.limit}
+	if next.Sub(now) <= burst {
+		g.tat = next
+		tat = next
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = untilRecovery(next.Sub(now)-burst, g.interval)
+	}
+
+	decision.Remaining = int((burst - tat.Sub(now)) / g.interval)
+	if decision.Remaining < 0 {
+		decision.Remaining = 0
+	}
+	decision.Reset = untilRecovery(tat.Sub(now), g.interval)
+	return decision
+}
+
+// SetLimit меняет лимит; TAT сохраняется
+func (g *GCRA) SetLimit(capacity int, refillRate float64, now time.Time) {
+	g.limit = capacity
+	g.interval = intervalFor(refillRate)
+}
+
+// LeakyBucket ставит запросы в очередь до capacity и выпускает их равномерно со
+// скоростью refill_rate: запрос пропускается с задержкой Decision.Delay, а при
+// заполненной очереди отклоняется
+type LeakyBucket struct {
+	capacity int
+	interval time.Duration
+	next     time.Time // Время, когда может быть выпущен следующий запрос
+}
+
+// NewLeakyBucket создает дырявое ведро
+func NewLeakyBucket(capacity int, refillRate float64) *LeakyBucket {
+	return &LeakyBucket{capacity: capacity, interval: intervalFor(refillRate)}
+}
+
+// Allow ставит запрос в очередь, если в ней есть место
+func (b *LeakyBucket) Allow(now time.Time) Decision {
+	start := b.next
+	if start.Before(now) {
+		start = now
+	}
+	delay := start.Sub(now)
+	maxDelay := mulDuration(b.capacity-1, b.interval)
+	if b.interval >= foreverWindow {
+		// При нулевой скорости очередь не освобождается: пропускается только запрос
+		// без задержки, иначе он ждал бы выпуска бесконечно
+		maxDelay = 0
+	}
+
+	decision := Decision{Limit: b.capacity}
+	if b.capacity > 0 && delay <= maxDelay {
+		b.next = start.Add(b.interval)
+		decision.Allowed = true
+		decision.Delay = delay
+	} else if b.capacity > 0 {
+		decision.RetryAfter = untilRecovery(delay-maxDelay, b.interval)
+	}
+
+	queued := 0
+	if b.next.After(now) {
+		queued = int(math.Ceil(float64(b.next.Sub(now)) / float64(b.interval)))
+	}
+	decision.Remaining = b.capacity - queued
+	if decision.Remaining < 0 {
+		decision.Remaining = 0
+	}
+	if b.next.After(now) {
+		decision.Reset = untilRecovery(b.next.Sub(now), b.interval)
+	}
+	return decision
+}
+
+// SetLimit меняет размер очереди и скорость; уже запланированные запросы сохраняются
+func (b *LeakyBucket) SetLimit(capacity int, refillRate float64, now time.Time) {
+	b.capacity = capacity
+	b.interval = intervalFor(refillRate)
+}
@@ -0,0 +1,297 @@
+package ratelimiter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// base начало минуты, чтобы окна длиной в делитель минуты начинались с него
+var base = time.Unix(1700000000, 0).Truncate(time.Minute)
+
+func TestFixedWindow(t *testing.T) {
+	w := NewFixedWindow(3, 1) // 3 запроса за 3 секунды
+
+	for i := 0; i < 3; i++ {
+		require.True(t, w.Allow(base).Allowed)
+	}
+	decision := w.Allow(base.Add(2 * time.Second))
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, time.Second, decision.RetryAfter)
+	assert.Equal(t, 0, decision.Remaining)
+
+	decision = w.Allow(base.Add(3 * time.Second))
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 2, decision.Remaining)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	w := NewSlidingWindow(4, 2) // 4 запроса за 2 секунды
+
+	for i := 0; i < 4; i++ {
+		require.True(t, w.Allow(base).Allowed)
+	}
+	assert.False(t, w.Allow(base).Allowed)
+
+	// В начале следующего окна предыдущее учитывается полностью
+	decision := w.Allow(base.Add(2 * time.Second))
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 500*time.Millisecond, decision.RetryAfter)
+
+	// Через четверть окна вес предыдущего - 3 запроса
+	assert.True(t, w.Allow(base.Add(2500*time.Millisecond)).Allowed)
+	assert.False(t, w.Allow(base.Add(2500*time.Millisecond)).Allowed)
+}
+
+func TestSlidingLog(t *testing.T) {
+	l := NewSlidingLog(2, 1) // 2 запроса за 2 секунды
+
+	require.True(t, l.Allow(base).Allowed)
+	require.True(t, l.Allow(base.Add(time.Second)).Allowed)
+
+	decision := l.Allow(base.Add(1500 * time.Millisecond))
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 500*time.Millisecond, decision.RetryAfter)
+
+	// Первый запрос вышел из окна, второй еще в нем
+	assert.True(t, l.Allow(base.Add(2*time.Second)).Allowed)
+	assert.False(t, l.Allow(base.Add(2*time.Second)).Allowed)
+}
+
+func TestGCRA(t *testing.T) {
+	g := NewGCRA(2, 1)
+
+	decision := g.Allow(base)
+	require.True(t, decision.Allowed)
+	assert.Equal(t, 1, decision.Remaining)
+	require.True(t, g.Allow(base).Allowed)
+
+	decision = g.Allow(base)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, time.Second, decision.RetryAfter)
+	assert.Equal(t, 2*time.Second, decision.Reset)
+
+	assert.True(t, g.Allow(base.Add(time.Second)).Allowed)
+}
+
+func TestLeakyBucket(t *testing.T) {
+	b := NewLeakyBucket(3, 2) // Очередь из 3 запросов, выпуск каждые 0.5s
+
+	for _, delay := range []time.Duration{0, 500 * time.Millisecond, time.Second} {
+		decision := b.Allow(base)
+		require.True(t, decision.Allowed)
+		assert.Equal(t, delay, decision.Delay)
+	}
+
+	decision := b.Allow(base)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 500*time.Millisecond, decision.RetryAfter)
+
+	// Через секунду выпущены два запроса
+	decision = b.Allow(base.Add(time.Second))
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 500*time.Millisecond, decision.Delay)
+}
+
+// TestAlgorithmsLongRunRate проверяет, что при перегрузке любой алгоритм
+// пропускает около refill_rate запросов в секунду, с всплеском не больше емкости
+func TestAlgorithmsLongRunRate(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for _, name := range Algorithms() {
+		for i := 0; i < 20; i++ {
+			capacity := 1 + rng.Intn(20)
+			rate := 0.5 + rng.Float64()*50
+			meanGap := time.Duration(float64(time.Second) / rate / 4)
+			horizon := time.Duration(float64(time.Second) * (50 + float64(capacity)) / rate)
+
+			now := base
+			algorithm, err := NewAlgorithm(name, capacity, rate, now)
+			require.NoError(t, err)
+
+			admitted := 0
+			for now.Sub(base) < horizon {
+				if algorithm.Allow(now).Allowed {
+					admitted++
+				}
+				now = now.Add(time.Duration(rng.Int63n(int64(2*meanGap)) + 1))
+			}
+
+			// Оконные алгоритмы теряют часть окна на паузе перед первым запросом
+			// в нем, поэтому снизу допускается недобор
+			steady := rate * now.Sub(base).Seconds()
+			assert.GreaterOrEqual(t, float64(admitted), 0.75*steady-2,
+				"%s capacity=%d rate=%.2f", name, capacity, rate)
+			assert.LessOrEqual(t, float64(admitted), steady+float64(capacity)+2,
+				"%s capacity=%d rate=%.2f", name, capacity, rate)
+		}
+	}
+}
+
+// TestAlgorithmsWithoutRefill проверяет, что при нулевой емкости или скорости
+// алгоритмы не переполняют длительности и не обещают многолетнее ожидание
+func TestAlgorithmsWithoutRefill(t *testing.T) {
+	for _, name := range Algorithms() {
+		for _, capacity := range []int{0, 1, 5} {
+			algorithm, err := NewAlgorithm(name, capacity, 0, base)
+			require.NoError(t, err)
+
+			admitted := 0
+			for i := 0; i < 10; i++ {
+				decision := algorithm.Allow(base.Add(time.Duration(i) * time.Second))
+				if decision.Allowed {
+					admitted++
+				}
+				for _, d := range []time.Duration{decision.Reset, decision.RetryAfter, decision.Delay} {
+					assert.True(t, d >= 0 && d < time.Hour, "%s capacity=%d: %v", name, capacity, d)
+				}
+			}
+			assert.LessOrEqual(t, admitted, capacity, "%s capacity=%d", name, capacity)
+			if capacity > 0 {
+				assert.Positive(t, admitted, "%s capacity=%d", name, capacity)
+			}
+		}
+	}
+
+	assert.Equal(t, foreverWindow, mulDuration(1000, foreverWindow))
+	assert.Equal(t, time.Duration(0), mulDuration(-1, time.Second))
+	assert.Equal(t, 3*time.Second, mulDuration(3, time.Second))
+}
+
+func TestAlgorithmsTinyRefillRate(t *testing.T) {
+	// При скорости 1e-12 время восстановления в наносекундах не помещается в int64
+	for _, name := range Algorithms() {
+		for _, rate := range []float64{1e-12, 0} {
+			algorithm, err := NewAlgorithm(name, 1, rate, base)
+			require.NoError(t, err)
+
+			for i := 0; i < 3; i++ {
+				decision := algorithm.Allow(base.Add(time.Duration(i) * time.Second))
+				for _, d := range []time.Duration{decision.Reset, decision.RetryAfter, decision.Delay} {
+					assert.True(t, d >= 0 && d < time.Hour, "%s rate=%v: %v", name, rate, d)
+				}
+			}
+		}
+	}
+
+	// Низкая, но конечная скорость: время ожидания сообщается без переполнения
+	bucket := NewTokenBucket(1, 1e-6, base)
+	bucket.Allow(base)
+	decision := bucket.Allow(base)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, time.Duration(1e6*float64(time.Second)), decision.RetryAfter)
+
+	assert.Equal(t, foreverWindow, secondsDuration(1e12))
+	assert.Equal(t, foreverWindow, windowFor(1, 1e-12))
+	assert.Equal(t, foreverWindow, intervalFor(1e-12))
+	assert.Equal(t, time.Duration(0), secondsDuration(-1))
+}
+
+func TestNewAlgorithmUnknown(t *testing.T) {
+	_, err := NewAlgorithm("unknown", 1, 1, base)
+	assert.Error(t, err)
+
+	limiter, _ := newTestLimiter(t, 1, 1)
+	assert.Error(t, limiter.SetDefaultAlgorithm("unknown"))
+}
+
+func TestClientAlgorithmAPI(t *testing.T) {
+	limiter, _ := newTestLimiter(t, 10, 1)
+	router := mux.NewRouter()
+	limiter.RegisterClientRoutes(router)
+
+	do := func(method, url, body string) (*httptest.ResponseRecorder, ClientLimitResponse) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, url, bytes.NewBufferString(body)))
+		var resp ClientLimitResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+
+	rec, resp := do(http.MethodPost, "/clients?client_id=c1", `{"algorithm":"gcra","capacity":5,"refill_rate":2}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, GCRAAlgorithm, resp.Algorithm)
+
+	// Без алгоритма в запросе сохраняется текущий
+	rec, resp = do(http.MethodPut, "/clients/c1", `{"capacity":7,"refill_rate":3}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, GCRAAlgorithm, resp.Algorithm)
+	assert.Equal(t, 7, resp.Capacity)
+
+	rec, _ = do(http.MethodPut, "/clients/c1", `{"algorithm":"unknown","capacity":7,"refill_rate":3}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Новый клиент без алгоритма получает алгоритм по умолчанию
+	require.NoError(t, limiter.SetDefaultAlgorithm(FixedWindowAlgorithm))
+	_, resp = do(http.MethodPost, "/clients?client_id=c2", `{"capacity":5,"refill_rate":2}`)
+	assert.Equal(t, FixedWindowAlgorithm, resp.Algorithm)
+
+	_, resp = do(http.MethodGet, "/clients/c1", "")
+	assert.Equal(t, GCRAAlgorithm, resp.Algorithm)
+	assert.Equal(t, 3.0, resp.RefillRate)
+}
+
+func TestInvalidLimit(t *testing.T) {
+	limiter, _ := newTestLimiter(t, 10, 1)
+	router := mux.NewRouter()
+	limiter.RegisterClientRoutes(router)
+	limiter.SetClientLimit("c1", 5, 1)
+
+	for _, body := range []string{
+		`{"algorithm":"sliding-log","capacity":0,"refill_rate":1}`,
+		`{"algorithm":"sliding-log","capacity":-1,"refill_rate":1}`,
+		`{"capacity":5,"refill_rate":-1}`,
+	} {
+		for method, url := range map[string]string{http.MethodPost: "/clients?client_id=c2", http.MethodPut: "/clients/c1"} {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(method, url, bytes.NewBufferString(body)))
+			assert.Equal(t, http.StatusBadRequest, rec.Code, "%s %s", method, body)
+		}
+	}
+	assert.Error(t, limiter.SetClientLimitWithAlgorithm("c2", SlidingLogAlgorithm, 0, 1))
+
+	_, exists := limiter.GetClientLimit("c2")
+	assert.False(t, exists)
+	limit, _ := limiter.GetClientLimit("c1")
+	assert.Equal(t, 5, limit.Capacity)
+
+	// Журнал с неположительным лимитом отклоняет запросы, а не обращается за границу журнала
+	for _, capacity := range []int{0, -1} {
+		l := NewSlidingLog(2, 1)
+		require.True(t, l.Allow(base).Allowed)
+		l.SetLimit(capacity, 1, base)
+		decision := l.Allow(base)
+		assert.False(t, decision.Allowed)
+		assert.Equal(t, 0, decision.Remaining)
+	}
+}
+
+func TestLeakyBucketMiddlewareCancel(t *testing.T) {
+	limiter, _ := newTestLimiter(t, 2, 1)
+	require.NoError(t, limiter.SetDefaultAlgorithm(LeakyBucketAlgorithm))
+
+	served := 0
+	handler := RateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		req.Header.Set("X-API-Key", "client")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Первый запрос выпущен сразу, второй ждал в очереди и отменен клиентом
+	assert.Equal(t, 1, served)
+}
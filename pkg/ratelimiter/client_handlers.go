@@ -5,18 +5,32 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+
+	"load-balancer/pkg/requestid"
+	"load-balancer/pkg/storage"
 )
 
 // ClientLimitRequest структура для запроса создания/обновления клиента
 // Используется для парсинга JSON тела запроса
 type ClientLimitRequest struct {
+	Algorithm  string  `json:"algorithm,omitempty"` // Пустой алгоритм сохраняет текущий
 	Capacity   int     `json:"capacity"`
 	RefillRate float64 `json:"refill_rate"`
 }
 
+// limit преобразует запрос в настройки лимита
+func (req ClientLimitRequest) limit() storage.ClientLimit {
+	return storage.ClientLimit{
+		Algorithm:  req.Algorithm,
+		Capacity:   req.Capacity,
+		RefillRate: req.RefillRate,
+	}
+}
+
 // ClientLimitResponse структура для ответа с информацией о клиенте
 type ClientLimitResponse struct {
 	ClientID   string  `json:"client_id"`
+	Algorithm  string  `json:"algorithm,omitempty"`
 	Capacity   int     `json:"capacity"`
 	RefillRate float64 `json:"refill_rate"`
 	Message    string  `json:"message,omitempty"`
@@ -24,32 +38,48 @@ type ClientLimitResponse struct {
 
 // ErrorResponse структура для ответа с ошибкой
 type ErrorResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code      int    `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // CreateClientHandler обрабатывает запросы на создание нового клиента
 func (rl *RateLimiter) CreateClientHandler(w http.ResponseWriter, r *http.Request) {
 	var req ClientLimitRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		sendErrorResponse(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	clientID := r.URL.Query().Get("client_id")
 	if clientID == "" {
-		sendErrorResponse(w, http.StatusBadRequest, "client_id is required")
+		sendErrorResponse(w, r, http.StatusBadRequest, "client_id is required")
+		return
+	}
+
+	if req.Algorithm != "" && !IsAlgorithm(req.Algorithm) {
+		sendErrorResponse(w, r, http.StatusBadRequest, "Unknown algorithm")
 		return
 	}
 
-	rl.SetClientLimit(clientID, req.Capacity, req.RefillRate)
+	if !validLimit(req.Capacity, req.RefillRate) {
+		sendErrorResponse(w, r, http.StatusBadRequest, "Capacity must be positive and refill_rate must not be negative")
+		return
+	}
+
+	limit, err := rl.setClientLimit(clientID, req.limit(), rl.loggerFor(r))
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(ClientLimitResponse{
 		ClientID:   clientID,
-		Capacity:   req.Capacity,
-		RefillRate: req.RefillRate,
+		Algorithm:  limit.Algorithm,
+		Capacity:   limit.Capacity,
+		RefillRate: limit.RefillRate,
 		Message:    "Client created successfully",
 	})
 }
@@ -61,25 +91,40 @@ func (rl *RateLimiter) UpdateClientHandler(w http.ResponseWriter, r *http.Reques
 
 	var req ClientLimitRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		sendErrorResponse(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Algorithm != "" && !IsAlgorithm(req.Algorithm) {
+		sendErrorResponse(w, r, http.StatusBadRequest, "Unknown algorithm")
+		return
+	}
+
+	if !validLimit(req.Capacity, req.RefillRate) {
+		sendErrorResponse(w, r, http.StatusBadRequest, "Capacity must be positive and refill_rate must not be negative")
 		return
 	}
 
 	// Проверяем существование клиента
-	_, _, exists := rl.GetClientLimit(clientID)
+	_, exists := rl.GetClientLimit(clientID)
 	if !exists {
-		sendErrorResponse(w, http.StatusNotFound, "Client not found")
+		sendErrorResponse(w, r, http.StatusNotFound, "Client not found")
 		return
 	}
 
-	rl.SetClientLimit(clientID, req.Capacity, req.RefillRate)
+	limit, err := rl.setClientLimit(clientID, req.limit(), rl.loggerFor(r))
+	if err != nil {
+		sendErrorResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(ClientLimitResponse{
 		ClientID:   clientID,
-		Capacity:   req.Capacity,
-		RefillRate: req.RefillRate,
+		Algorithm:  limit.Algorithm,
+		Capacity:   limit.Capacity,
+		RefillRate: limit.RefillRate,
 		Message:    "Client updated successfully",
 	})
 }
@@ -89,17 +134,18 @@ func (rl *RateLimiter) GetClientHandler(w http.ResponseWriter, r *http.Request)
 	vars := mux.Vars(r)
 	clientID := vars["client_id"]
 
-	capacity, refillRate, exists := rl.GetClientLimit(clientID)
+	limit, exists := rl.GetClientLimit(clientID)
 	if !exists {
-		sendErrorResponse(w, http.StatusNotFound, "Client not found")
+		sendErrorResponse(w, r, http.StatusNotFound, "Client not found")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(ClientLimitResponse{
 		ClientID:   clientID,
-		Capacity:   capacity,
-		RefillRate: refillRate,
+		Algorithm:  limit.Algorithm,
+		Capacity:   limit.Capacity,
+		RefillRate: limit.RefillRate,
 	})
 }
 
@@ -109,15 +155,15 @@ func (rl *RateLimiter) DeleteClientHandler(w http.ResponseWriter, r *http.Reques
 	clientID := vars["client_id"]
 
 	// Проверяем существование клиента
-	_, _, exists := rl.GetClientLimit(clientID)
+	_, exists := rl.GetClientLimit(clientID)
 	if !exists {
-		sendErrorResponse(w, http.StatusNotFound, "Client not found")
+		sendErrorResponse(w, r, http.StatusNotFound, "Client not found")
 		return
 	}
 
-	err := rl.DeleteClientLimit(clientID)
+	err := rl.deleteClientLimit(clientID, rl.loggerFor(r))
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, "Failed to delete client")
+		sendErrorResponse(w, r, http.StatusInternalServerError, "Failed to delete client")
 		return
 	}
 
@@ -146,11 +192,12 @@ func (rl *RateLimiter) RegisterClientRoutes(router *mux.Router) {
 }
 
 // sendErrorResponse отправляет структурированный JSON-ответ с ошибкой
-func sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+func sendErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(ErrorResponse{
-		Code:    statusCode,
-		Message: message,
+		Code:      statusCode,
+		Message:   message,
+		RequestID: requestid.FromContext(r.Context()),
 	})
 }
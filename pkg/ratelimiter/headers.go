@@ -0,0 +1,34 @@
+package ratelimiter
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// setRateLimitHeaders выставляет заголовки о лимите в двух вариантах:
+// RateLimit-* из черновика IETF (Reset - секунды до восстановления) и
+// распространенные X-RateLimit-* (Reset - время восстановления в Unix-секундах)
+func setRateLimitHeaders(h http.Header, decision Decision, now time.Time) {
+	limit := strconv.Itoa(decision.Limit)
+	remaining := strconv.Itoa(decision.Remaining)
+	reset := ceilSeconds(decision.Reset)
+
+	h.Set("RateLimit-Limit", limit)
+	h.Set("RateLimit-Remaining", remaining)
+	h.Set("RateLimit-Reset", strconv.Itoa(reset))
+
+	h.Set("X-RateLimit-Limit", limit)
+	h.Set("X-RateLimit-Remaining", remaining)
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(time.Duration(reset)*time.Second).Unix(), 10))
+}
+
+// ceilSeconds округляет длительность вверх до целых секунд, чтобы клиент,
+// выждавший указанное время, не получил отказ повторно
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
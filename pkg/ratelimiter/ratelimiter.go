@@ -1,10 +1,18 @@
 package ratelimiter
 
 import (
+	"fmt"
+	"load-balancer/pkg/clientip"
+	"load-balancer/pkg/requestid"
 	"load-balancer/pkg/storage"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Logger интерфейс для логирования
@@ -13,36 +21,131 @@ type Logger interface {
 	Infof(format string, args ...interface{})
 	Warnf(format string, args ...interface{})
 	Errorf(format string, args ...interface{})
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// requestLogger добавляет к сообщениям идентификатор запроса отдельным полем
+type requestLogger struct {
+	Logger
+	requestID string
+}
+
+func (l requestLogger) Debugf(format string, args ...interface{}) {
+	l.Debugw(fmt.Sprintf(format, args...))
+}
+
+func (l requestLogger) Infof(format string, args ...interface{}) {
+	l.Infow(fmt.Sprintf(format, args...))
+}
+
+func (l requestLogger) Warnf(format string, args ...interface{}) {
+	l.Warnw(fmt.Sprintf(format, args...))
+}
+
+func (l requestLogger) Errorf(format string, args ...interface{}) {
+	l.Errorw(fmt.Sprintf(format, args...))
+}
+
+func (l requestLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.Logger.Debugw(msg, append(keysAndValues, "request_id", l.requestID)...)
+}
+
+func (l requestLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.Logger.Infow(msg, append(keysAndValues, "request_id", l.requestID)...)
+}
+
+func (l requestLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.Logger.Warnw(msg, append(keysAndValues, "request_id", l.requestID)...)
+}
+
+func (l requestLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.Logger.Errorw(msg, append(keysAndValues, "request_id", l.requestID)...)
+}
+
+// loggerFor возвращает логгер, помечающий сообщения идентификатором запроса
+func (rl *RateLimiter) loggerFor(r *http.Request) Logger {
+	id := requestid.FromContext(r.Context())
+	if id == "" {
+		return rl.logger
+	}
+	return requestLogger{Logger: rl.logger, requestID: id}
+}
+
+// Metrics интерфейс для сбора метрик решений ограничителя
+type Metrics interface {
+	ObserveDecision(clientID string, allowed bool)
 }
 
-// TokenBucket представляет ведро токенов для отдельного клиента
-type TokenBucket struct {
-	capacity   int       // Максимальное количество токенов
-	tokens     int       // Текущее количество токенов
-	refillRate float64   // Токенов в секунду
-	lastRefill time.Time // Время последнего пополнения
+// noopMetrics используется, пока метрики не подключены
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveDecision(string, bool) {}
+
+// clientLimiter состояние ограничения отдельного клиента
+type clientLimiter struct {
+	limit      storage.ClientLimit // Настройки с явно указанным алгоритмом
+	algorithm  Algorithm
 	lastAccess time.Time // Время последнего доступа (для очистки неактивных)
 	mutex      sync.Mutex
 }
 
+// newClientLimiter создает состояние клиента; пустой алгоритм означает ведро
+// токенов, с которым сохранены настройки до появления выбора алгоритма.
+// Вызывается под блокировкой ограничителя
+func (rl *RateLimiter) newClientLimiter(clientID string, limit storage.ClientLimit, now time.Time) (*clientLimiter, error) {
+	if limit.Algorithm == "" {
+		limit.Algorithm = TokenBucketAlgorithm
+	}
+
+	algorithm, err := rl.newAlgorithm(clientID, limit, now)
+	if err != nil {
+		return nil, err
+	}
+	return &clientLimiter{limit: limit, algorithm: algorithm, lastAccess: now}, nil
+}
+
+// newAlgorithm создает алгоритм клиента. В распределенном режиме ведро токенов
+// хранится в общем хранилище, остальные алгоритмы ограничивают каждый экземпляр
+// отдельно. Вызывается под блокировкой ограничителя
+func (rl *RateLimiter) newAlgorithm(clientID string, limit storage.ClientLimit, now time.Time) (Algorithm, error) {
+	if rl.shared != nil && limit.Algorithm == TokenBucketAlgorithm {
+		return NewSharedTokenBucket(*rl.shared, clientID, limit.Capacity, limit.RefillRate, now, rl.logger), nil
+	}
+	return NewAlgorithm(limit.Algorithm, limit.Capacity, limit.RefillRate, now)
+}
+
 // RateLimiter управляет ограничением запросов для всех клиентов
 type RateLimiter struct {
-	buckets     map[string]*TokenBucket // Ведра токенов по IP/API-ключу
-	defaultCap  int                     // Емкость по умолчанию
-	defaultRate float64                 // Скорость пополнения по умолчанию
-	logger      Logger
-	storage     storage.Storage // Хранилище настроек
-	mutex       sync.RWMutex
+	clients          map[string]*clientLimiter // Состояние по IP/API-ключу
+	defaultCap       int                       // Емкость по умолчанию
+	defaultRate      float64                   // Скорость пополнения по умолчанию
+	defaultAlgorithm string                    // Алгоритм по умолчанию
+	shared           *SharedOptions            // Общее хранилище ведер; nil, если каждый экземпляр ограничивает сам
+	logger           Logger
+	metrics          Metrics
+	storage          storage.Storage  // Хранилище настроек
+	now              func() time.Time // Часы; подменяются в тестах
+	stopChan         chan struct{}
+	stopOnce         sync.Once
+	mutex            sync.RWMutex
 }
 
-// NewRateLimiter создает экземпляр ограничителя запросов
+// NewRateLimiter создает экземпляр ограничителя запросов. По умолчанию
+// используется ведро токенов, другой алгоритм задается SetDefaultAlgorithm
 func NewRateLimiter(defaultCap int, defaultRate float64, logger Logger, storage storage.Storage) *RateLimiter {
 	limiter := &RateLimiter{
-		buckets:     make(map[string]*TokenBucket),
-		defaultCap:  defaultCap,
-		defaultRate: defaultRate,
-		logger:      logger,
-		storage:     storage,
+		clients:          make(map[string]*clientLimiter),
+		defaultCap:       defaultCap,
+		defaultRate:      defaultRate,
+		defaultAlgorithm: TokenBucketAlgorithm,
+		logger:           logger,
+		metrics:          noopMetrics{},
+		storage:          storage,
+		stopChan:         make(chan struct{}),
+		now:              time.Now,
 	}
 
 	// Загружаем настройки из хранилища
@@ -50,11 +153,8 @@ func NewRateLimiter(defaultCap int, defaultRate float64, logger Logger, storage
 		limiter.loadLimitsFromStorage()
 	}
 
-	// Запускаем периодическое обновление токенов
-	go limiter.refillTokens()
-
-	// Запускаем периодическую очистку неактивных buckets
-	go limiter.cleanupInactiveBuckets()
+	// Запускаем периодическую очистку неактивных клиентов
+	go limiter.cleanupInactiveClients()
 
 	return limiter
 }
@@ -67,239 +167,330 @@ func (rl *RateLimiter) loadLimitsFromStorage() {
 		return
 	}
 
-	for clientID, limit := range clientLimits {
-		rl.createBucketInMemory(clientID, limit.Capacity, limit.RefillRate)
-		rl.logger.Debugf("Загружены настройки для клиента %s из хранилища: capacity=%d, rate=%.2f",
-			clientID, limit.Capacity, limit.RefillRate)
-	}
-}
-
-// createBucketInMemory создает новый бакет в памяти без обращения к хранилищу
-func (rl *RateLimiter) createBucketInMemory(clientID string, capacity int, refillRate float64) {
 	rl.mutex.Lock()
 	defer rl.mutex.Unlock()
 
-	now := time.Now()
-	rl.buckets[clientID] = &TokenBucket{
-		capacity:   capacity,
-		tokens:     capacity,
-		refillRate: refillRate,
-		lastRefill: now,
-		lastAccess: now,
+	for clientID, limit := range clientLimits {
+		client, err := rl.newClientLimiter(clientID, limit, rl.now())
+		if err != nil {
+			rl.logger.Warnf("Пропущены настройки клиента %s из хранилища: %v", clientID, err)
+			continue
+		}
+		rl.clients[clientID] = client
+		rl.logger.Debugf("Загружены настройки для клиента %s из хранилища: algorithm=%s, capacity=%d, rate=%.2f",
+			clientID, client.limit.Algorithm, limit.Capacity, limit.RefillRate)
 	}
 }
 
-// Allow проверяет, допустим ли запрос от клиента
-func (rl *RateLimiter) Allow(clientID string) bool {
-	rl.logger.Infof("Проверка лимита для клиента: %s", clientID)
-
-	bucket := rl.getBucket(clientID)
+// Decision результат проверки лимита
+type Decision struct {
+	Allowed    bool
+	Limit      int           // Емкость ведра или лимит окна
+	Remaining  int           // Запросов можно сделать сразу после этого
+	Reset      time.Duration // Время до полного восстановления лимита
+	RetryAfter time.Duration // Время до появления возможности сделать запрос; 0, если запрос разрешен
+	Delay      time.Duration // На сколько придержать разрешенный запрос (leaky bucket)
+}
 
-	bucket.mutex.Lock()
-	defer bucket.mutex.Unlock()
+// Allow проверяет, допустим ли запрос от клиента
+func (rl *RateLimiter) Allow(clientID string) Decision {
+	return rl.allow(clientID, rl.logger)
+}
 
-	// Пополняем токены с учетом прошедшего времени
-	rl.refillBucket(bucket)
+// allow проверяет лимит, записывая сообщения в указанный логгер
+func (rl *RateLimiter) allow(clientID string, log Logger) Decision {
+	log.Debugf("Проверка лимита для клиента: %s", clientID)
 
-	// Отладочная информация
-	rl.logger.Debugf("Клиент: %s, емкость: %d, текущие токены: %d",
-		clientID, bucket.capacity, bucket.tokens)
+	client := rl.getClient(clientID, log)
 
-	// Обновляем время последнего доступа
-	bucket.lastAccess = time.Now()
+	client.mutex.Lock()
+	now := rl.now()
+	client.lastAccess = now
+	decision := client.algorithm.Allow(now)
+	algorithm := client.limit.Algorithm
+	client.mutex.Unlock()
 
-	if bucket.tokens > 0 {
-		bucket.tokens--
-		rl.logger.Infof("Запрос разрешен для клиента %s (осталось токенов: %d)",
-			clientID, bucket.tokens)
-		return true
+	if decision.Allowed {
+		log.Debugf("Запрос разрешен для клиента %s (%s, осталось: %d, задержка: %v)",
+			clientID, algorithm, decision.Remaining, decision.Delay)
+	} else {
+		log.Debugf("Запрос отклонен для клиента %s (%s, повтор через %v)", clientID, algorithm, decision.RetryAfter)
 	}
 
-	rl.logger.Infof("Запрос отклонен для клиента %s (нет токенов)", clientID)
-	return false
+	rl.metrics.ObserveDecision(clientID, decision.Allowed)
+	return decision
 }
 
-// getBucket возвращает ведро для клиента (создает новое, если нужно)
-func (rl *RateLimiter) getBucket(clientID string) *TokenBucket {
+// getClient возвращает состояние клиента (создает новое, если нужно)
+func (rl *RateLimiter) getClient(clientID string, log Logger) *clientLimiter {
 	// Сначала проверяем без блокировки на запись
 	rl.mutex.RLock()
-	bucket, exists := rl.buckets[clientID]
+	client, exists := rl.clients[clientID]
+	limit := storage.ClientLimit{
+		Algorithm:  rl.defaultAlgorithm,
+		Capacity:   rl.defaultCap,
+		RefillRate: rl.defaultRate,
+	}
 	rl.mutex.RUnlock()
 
 	if exists {
-		return bucket
+		return client
 	}
 
-	// Если ведра нет, проверяем настройки в хранилище
-	var capacity int = rl.defaultCap
-	var refillRate float64 = rl.defaultRate
+	// Если клиента нет, проверяем настройки в хранилище
 	var storedSettings bool = false
 
 	if rl.storage != nil {
-		storedCapacity, storedRate, exists, err := rl.storage.GetClientLimit(clientID)
+		storedLimit, exists, err := rl.storage.GetClientLimit(clientID)
 		if err != nil {
-			rl.logger.Warnf("Ошибка при получении настроек из хранилища для %s: %v", clientID, err)
+			log.Warnf("Ошибка при получении настроек из хранилища для %s: %v", clientID, err)
 		} else if exists {
-			capacity = storedCapacity
-			refillRate = storedRate
+			limit = storedLimit
 			storedSettings = true
 		}
 	}
 
-	// Создаем новое ведро (блокировка на запись)
+	// Создаем состояние клиента (блокировка на запись)
 	rl.mutex.Lock()
 	defer rl.mutex.Unlock()
 
 	// Проверяем еще раз после получения эксклюзивной блокировки
-	bucket, exists = rl.buckets[clientID]
+	client, exists = rl.clients[clientID]
 	if exists {
-		return bucket
+		return client
 	}
 
-	// Создаем новое ведро
-	now := time.Now()
-	bucket = &TokenBucket{
-		capacity:   capacity,
-		tokens:     capacity,
-		refillRate: refillRate,
-		lastRefill: now,
-		lastAccess: now,
+	client, err := rl.newClientLimiter(clientID, limit, rl.now())
+	if err != nil {
+		// В хранилище записан неизвестный алгоритм, используем настройки по умолчанию
+		log.Warnf("Настройки клиента %s из хранилища не применены: %v", clientID, err)
+		limit = storage.ClientLimit{Algorithm: rl.defaultAlgorithm, Capacity: rl.defaultCap, RefillRate: rl.defaultRate}
+		client, _ = rl.newClientLimiter(clientID, limit, rl.now())
 	}
-
-	rl.buckets[clientID] = bucket
+	rl.clients[clientID] = client
 
 	// Если не нашли настройки в хранилище, сохраняем дефолтные
 	if rl.storage != nil && !storedSettings {
 		go func() {
-			if err := rl.storage.SaveClientLimit(clientID, capacity, refillRate); err != nil {
-				rl.logger.Warnf("Не удалось сохранить дефолтные настройки лимита для клиента %s: %v", clientID, err)
+			if err := rl.storage.SaveClientLimit(clientID, limit); err != nil {
+				log.Warnf("Не удалось сохранить дефолтные настройки лимита для клиента %s: %v", clientID, err)
 			}
 		}()
 	}
 
-	rl.logger.Infof("Создано новое ведро токенов для клиента %s", clientID)
-	return bucket
+	log.Infof("Создан ограничитель %s для клиента %s", client.limit.Algorithm, clientID)
+	return client
 }
 
-// refillBucket пополняет токены в ведре с учетом прошедшего времени
-func (rl *RateLimiter) refillBucket(bucket *TokenBucket) {
-	now := time.Now()
-	elapsed := now.Sub(bucket.lastRefill).Seconds()
-
-	// Добавляем токены согласно скорости пополнения
-	newTokens := int(elapsed * bucket.refillRate)
-	if newTokens > 0 {
-		bucket.tokens += newTokens
-		if bucket.tokens > bucket.capacity {
-			bucket.tokens = bucket.capacity
-		}
-		bucket.lastRefill = now
-	}
-}
+// cleanupInactiveClients периодически удаляет состояние неактивных клиентов
+func (rl *RateLimiter) cleanupInactiveClients() {
+	ticker := time.NewTicker(60 * time.Second)
+	defer ticker.Stop()
 
-// refillTokens периодически обновляет токены для всех клиентов
-func (rl *RateLimiter) refillTokens() {
-	ticker := time.NewTicker(1 * time.Second)
-	for range ticker.C {
-		rl.mutex.RLock()
-		for _, bucket := range rl.buckets {
-			bucket.mutex.Lock()
-			rl.refillBucket(bucket)
-			bucket.mutex.Unlock()
+	for {
+		select {
+		case <-ticker.C:
+		case <-rl.stopChan:
+			return
 		}
-		rl.mutex.RUnlock()
-	}
-}
 
-// cleanupInactiveBuckets периодически удаляет неактивные buckets
-func (rl *RateLimiter) cleanupInactiveBuckets() {
-	ticker := time.NewTicker(60 * time.Second)
-	for range ticker.C {
-		now := time.Now()
+		now := rl.now()
 		inactiveThreshold := 30 * time.Minute
 
 		rl.mutex.Lock()
-		for clientID, bucket := range rl.buckets {
-			bucket.mutex.Lock()
-			inactive := now.Sub(bucket.lastAccess) > inactiveThreshold
-			bucket.mutex.Unlock()
+		for clientID, client := range rl.clients {
+			client.mutex.Lock()
+			inactive := now.Sub(client.lastAccess) > inactiveThreshold
+			client.mutex.Unlock()
 
 			if inactive {
-				delete(rl.buckets, clientID)
-				rl.logger.Infof("Удален неактивный bucket для клиента %s", clientID)
+				delete(rl.clients, clientID)
+				rl.logger.Infof("Удалено состояние неактивного клиента %s", clientID)
 			}
 		}
 		rl.mutex.Unlock()
 	}
 }
 
-// SetClientLimit устанавливает индивидуальные настройки лимита для клиента
+// SetShared включает распределенный режим: ведра токенов всех экземпляров хранятся
+// в общем хранилище. Вызывается до начала обработки запросов; клиенты, загруженные
+// из хранилища настроек, переводятся на общие ведра
+func (rl *RateLimiter) SetShared(options SharedOptions) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rl.shared = &options
+	now := rl.now()
+	for clientID, client := range rl.clients {
+		client.mutex.Lock()
+		if client.limit.Algorithm == TokenBucketAlgorithm {
+			client.algorithm, _ = rl.newAlgorithm(clientID, client.limit, now)
+		}
+		client.mutex.Unlock()
+	}
+}
+
+// SetMetrics подключает сбор метрик. Вызывается до начала обработки запросов
+func (rl *RateLimiter) SetMetrics(metrics Metrics) {
+	rl.metrics = metrics
+}
+
+// BucketCount возвращает количество клиентов, состояние которых хранится в памяти
+func (rl *RateLimiter) BucketCount() int {
+	rl.mutex.RLock()
+	defer rl.mutex.RUnlock()
+	return len(rl.clients)
+}
+
+// Stop останавливает фоновые задачи ограничителя
+func (rl *RateLimiter) Stop() {
+	rl.stopOnce.Do(func() {
+		close(rl.stopChan)
+	})
+}
+
+// SetClientLimit устанавливает индивидуальные настройки лимита для клиента,
+// сохраняя его текущий алгоритм
 func (rl *RateLimiter) SetClientLimit(clientID string, capacity int, refillRate float64) {
-	// Обновляем бакет в памяти
+	if _, err := rl.setClientLimit(clientID, storage.ClientLimit{Capacity: capacity, RefillRate: refillRate}, rl.logger); err != nil {
+		rl.logger.Errorf("Не удалось установить лимит для клиента %s: %v", clientID, err)
+	}
+}
+
+// SetClientLimitWithAlgorithm устанавливает настройки лимита и алгоритм для клиента
+func (rl *RateLimiter) SetClientLimitWithAlgorithm(clientID, algorithm string, capacity int, refillRate float64) error {
+	_, err := rl.setClientLimit(clientID, storage.ClientLimit{
+		Algorithm:  algorithm,
+		Capacity:   capacity,
+		RefillRate: refillRate,
+	}, rl.logger)
+	return err
+}
+
+// setClientLimit устанавливает настройки лимита, записывая сообщения в указанный логгер.
+// Пустой алгоритм сохраняет текущий алгоритм клиента, а для нового клиента
+// означает алгоритм по умолчанию. Возвращает примененные настройки
+func (rl *RateLimiter) setClientLimit(clientID string, limit storage.ClientLimit, log Logger) (storage.ClientLimit, error) {
+	if limit.Algorithm != "" && !IsAlgorithm(limit.Algorithm) {
+		return limit, fmt.Errorf("неизвестный алгоритм ограничения: %s", limit.Algorithm)
+	}
+	if !validLimit(limit.Capacity, limit.RefillRate) {
+		return limit, fmt.Errorf("неверные настройки лимита: capacity=%d, refill_rate=%.2f", limit.Capacity, limit.RefillRate)
+	}
+
+	// Обновляем состояние в памяти
 	rl.mutex.Lock()
-	bucket, exists := rl.buckets[clientID]
-	if exists {
-		bucket.mutex.Lock()
-		bucket.capacity = capacity
-		bucket.refillRate = refillRate
-		if bucket.tokens > capacity {
-			bucket.tokens = capacity
+	now := rl.now()
+	client, exists := rl.clients[clientID]
+	switch {
+	case exists:
+		client.mutex.Lock()
+		if limit.Algorithm == "" {
+			limit.Algorithm = client.limit.Algorithm
 		}
-		bucket.mutex.Unlock()
-	} else {
-		now := time.Now()
-		rl.buckets[clientID] = &TokenBucket{
-			capacity:   capacity,
-			tokens:     capacity,
-			refillRate: refillRate,
-			lastRefill: now,
-			lastAccess: now,
+		if limit.Algorithm == client.limit.Algorithm {
+			// Тот же алгоритм меняет настройки, сохраняя накопленное состояние
+			client.algorithm.SetLimit(limit.Capacity, limit.RefillRate, now)
+		} else {
+			client.algorithm, _ = rl.newAlgorithm(clientID, limit, now)
 		}
+		client.limit = limit
+		client.mutex.Unlock()
+	default:
+		if limit.Algorithm == "" {
+			limit.Algorithm = rl.defaultAlgorithm
+		}
+		rl.clients[clientID], _ = rl.newClientLimiter(clientID, limit, now)
 	}
 	rl.mutex.Unlock()
 
 	// Сохраняем настройки в хранилище, если оно доступно
 	if rl.storage != nil {
-		if err := rl.storage.SaveClientLimit(clientID, capacity, refillRate); err != nil {
-			rl.logger.Errorf("Не удалось сохранить настройки лимита для клиента %s: %v", clientID, err)
-			return
+		if err := rl.storage.SaveClientLimit(clientID, limit); err != nil {
+			log.Errorf("Не удалось сохранить настройки лимита для клиента %s: %v", clientID, err)
+			return limit, nil
 		}
 	}
 
-	rl.logger.Infof("Установлен лимит для клиента %s: capacity=%d, rate=%.2f", clientID, capacity, refillRate)
+	log.Infof("Установлен лимит для клиента %s: algorithm=%s, capacity=%d, rate=%.2f",
+		clientID, limit.Algorithm, limit.Capacity, limit.RefillRate)
+	return limit, nil
+}
+
+// validLimit проверяет настройки лимита: емкость должна быть положительной,
+// скорость пополнения неотрицательной
+func validLimit(capacity int, refillRate float64) bool {
+	return capacity > 0 && refillRate >= 0
+}
+
+// SetDefaults меняет настройки лимита по умолчанию. Они применяются к новым клиентам,
+// уже созданные клиенты сохраняют свои настройки
+func (rl *RateLimiter) SetDefaults(capacity int, refillRate float64) {
+	rl.mutex.Lock()
+	rl.defaultCap = capacity
+	rl.defaultRate = refillRate
+	rl.mutex.Unlock()
+
+	rl.logger.Infof("Установлены лимиты по умолчанию: capacity=%d, rate=%.2f", capacity, refillRate)
+}
+
+// SetDefaultAlgorithm меняет алгоритм по умолчанию для новых клиентов
+func (rl *RateLimiter) SetDefaultAlgorithm(algorithm string) error {
+	if !IsAlgorithm(algorithm) {
+		return fmt.Errorf("неизвестный алгоритм ограничения: %s", algorithm)
+	}
+
+	rl.mutex.Lock()
+	changed := rl.defaultAlgorithm != algorithm
+	rl.defaultAlgorithm = algorithm
+	rl.mutex.Unlock()
+
+	if changed {
+		rl.logger.Infof("Установлен алгоритм ограничения по умолчанию: %s", algorithm)
+	}
+	return nil
 }
 
 // GetClientLimit возвращает текущие настройки лимита для клиента
-func (rl *RateLimiter) GetClientLimit(clientID string) (capacity int, refillRate float64, exists bool) {
+func (rl *RateLimiter) GetClientLimit(clientID string) (limit storage.ClientLimit, exists bool) {
 	rl.mutex.RLock()
 	defer rl.mutex.RUnlock()
 
-	bucket, exists := rl.buckets[clientID]
+	client, exists := rl.clients[clientID]
 	if !exists {
-		return rl.defaultCap, rl.defaultRate, false
+		return storage.ClientLimit{
+			Algorithm:  rl.defaultAlgorithm,
+			Capacity:   rl.defaultCap,
+			RefillRate: rl.defaultRate,
+		}, false
 	}
 
-	bucket.mutex.Lock()
-	defer bucket.mutex.Unlock()
-	return bucket.capacity, bucket.refillRate, true
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.limit, true
 }
 
 // DeleteClientLimit удаляет настройки лимита для клиента
 func (rl *RateLimiter) DeleteClientLimit(clientID string) error {
+	return rl.deleteClientLimit(clientID, rl.logger)
+}
+
+// deleteClientLimit удаляет настройки лимита, записывая сообщения в указанный логгер
+func (rl *RateLimiter) deleteClientLimit(clientID string, log Logger) error {
 	// Удаляем из памяти
 	rl.mutex.Lock()
-	delete(rl.buckets, clientID)
+	delete(rl.clients, clientID)
 	rl.mutex.Unlock()
 
 	// Удаляем из хранилища, если оно доступно
 	if rl.storage != nil {
 		if err := rl.storage.DeleteClientLimit(clientID); err != nil {
-			rl.logger.Errorf("Не удалось удалить настройки лимита для клиента %s из хранилища: %v", clientID, err)
+			log.Errorf("Не удалось удалить настройки лимита для клиента %s из хранилища: %v", clientID, err)
 			return err
 		}
 	}
 
-	rl.logger.Infof("Удалены настройки лимита для клиента %s", clientID)
+	log.Infof("Удалены настройки лимита для клиента %s", clientID)
 	return nil
 }
 
@@ -308,41 +499,77 @@ func (rl *RateLimiter) GetAllClients() []ClientLimitResponse {
 	rl.mutex.RLock()
 	defer rl.mutex.RUnlock()
 
-	clients := make([]ClientLimitResponse, 0, len(rl.buckets))
+	clients := make([]ClientLimitResponse, 0, len(rl.clients))
 
-	for clientID, bucket := range rl.buckets {
-		bucket.mutex.Lock()
+	for clientID, client := range rl.clients {
+		client.mutex.Lock()
 		clients = append(clients, ClientLimitResponse{
 			ClientID:   clientID,
-			Capacity:   bucket.capacity,
-			RefillRate: bucket.refillRate,
+			Algorithm:  client.limit.Algorithm,
+			Capacity:   client.limit.Capacity,
+			RefillRate: client.limit.RefillRate,
 		})
-		bucket.mutex.Unlock()
+		client.mutex.Unlock()
 	}
 
 	return clients
 }
 
+// tracer создает спаны решений ограничителя
+var tracer = otel.Tracer("load-balancer/pkg/ratelimiter")
+
 // RateLimitMiddleware возвращает middleware для ограничения запросов
 func RateLimitMiddleware(limiter *RateLimiter) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			clientID := getClientID(r)
-			limiter.logger.Debugf("Обработка запроса от клиента: %s", clientID)
-
-			if !limiter.Allow(clientID) {
-				limiter.logger.Warnf("Превышен лимит запросов для клиента %s", clientID)
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusTooManyRequests)
-				w.Write([]byte(`{"code": 429, "message": "Rate limit exceeded"}`))
+			clientID := limiter.ClientID(r)
+			log := limiter.loggerFor(r)
+			log.Debugf("Обработка запроса от клиента: %s", clientID)
+
+			_, span := tracer.Start(r.Context(), "ratelimit", trace.WithAttributes(
+				attribute.String("ratelimit.client_id", clientID),
+			))
+			decision := limiter.allow(clientID, log)
+			span.SetAttributes(
+				attribute.Bool("ratelimit.allowed", decision.Allowed),
+				attribute.Int("ratelimit.remaining", decision.Remaining),
+				attribute.Int64("ratelimit.delay_ms", decision.Delay.Milliseconds()),
+			)
+			span.End()
+
+			setRateLimitHeaders(w.Header(), decision, limiter.now())
+
+			if !decision.Allowed {
+				log.Warnf("Превышен лимит запросов для клиента %s", clientID)
+				if decision.RetryAfter > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
+				}
+				sendErrorResponse(w, r, http.StatusTooManyRequests, "Rate limit exceeded")
 				return
 			}
 
+			// Leaky bucket выпускает запросы равномерно: придерживаем запрос до его очереди
+			if decision.Delay > 0 {
+				timer := time.NewTimer(decision.Delay)
+				select {
+				case <-timer.C:
+				case <-r.Context().Done():
+					timer.Stop()
+					log.Debugf("Клиент %s отменил запрос, ожидавший в очереди", clientID)
+					return
+				}
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// ClientID возвращает идентификатор клиента, по которому ограничивается запрос
+func (rl *RateLimiter) ClientID(r *http.Request) string {
+	return getClientID(r)
+}
+
 // getClientID определяет идентификатор клиента на основе API-ключа или IP-адреса
 func getClientID(r *http.Request) string {
 	// Прямое использование заголовка X-API-Key без добавления префикса
@@ -351,6 +578,7 @@ func getClientID(r *http.Request) string {
 		return apiKey
 	}
 
-	// Если API-ключ отсутствует, используем IP-адрес
-	return "ip:" + r.RemoteAddr
+	// Если API-ключ отсутствует, используем IP-адрес клиента (с учетом доверенных
+	// прокси и агрегации по сети, если настроены) без порта соединения
+	return "ip:" + clientip.KeyFromRequest(r)
 }
@@ -0,0 +1,181 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nopLogger отключает логирование в тестах
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Infof(string, ...interface{})  {}
+func (nopLogger) Warnf(string, ...interface{})  {}
+func (nopLogger) Errorf(string, ...interface{}) {}
+func (nopLogger) Debugw(string, ...interface{}) {}
+func (nopLogger) Infow(string, ...interface{})  {}
+func (nopLogger) Warnw(string, ...interface{})  {}
+func (nopLogger) Errorw(string, ...interface{}) {}
+
+// fakeClock управляемые часы для детерминированных тестов
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// newTestLimiter создает ограничитель с управляемыми часами
+func newTestLimiter(t *testing.T, capacity int, rate float64) (*RateLimiter, *fakeClock) {
+	t.Helper()
+	limiter := NewRateLimiter(capacity, rate, nopLogger{}, nil)
+	t.Cleanup(limiter.Stop)
+
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	limiter, clock := newTestLimiter(t, 2, 0.5)
+
+	handler := RateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", "client1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Remaining"))
+	assert.Empty(t, rec.Header().Get("Retry-After"))
+
+	do()
+	rec = do()
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+	assert.Equal(t, "4", rec.Header().Get("RateLimit-Reset"))
+
+	reset, err := strconv.ParseInt(rec.Header().Get("X-RateLimit-Reset"), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().Add(4*time.Second).Unix(), reset)
+
+	var body ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, http.StatusTooManyRequests, body.Code)
+}
+
+func TestFractionalRefill(t *testing.T) {
+	limiter, clock := newTestLimiter(t, 1, 0.5)
+
+	require.True(t, limiter.Allow("client").Allowed)
+
+	// Половина токена за секунду не теряется при следующем запросе
+	clock.Advance(time.Second)
+	decision := limiter.Allow("client")
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, time.Second, decision.RetryAfter)
+
+	clock.Advance(time.Second)
+	assert.True(t, limiter.Allow("client").Allowed)
+}
+
+// TestLongRunRate проверяет на случайных настройках и случайных интервалах между
+// запросами, что при перегрузке число пропущенных запросов равно емкости плюс
+// скорость, умноженная на время, и что ни в одном окне лимит не превышается
+func TestLongRunRate(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 200; i++ {
+		// При емкости 1 часть токена теряется на ограничении емкости, если запрос
+		// пришел позже появления токена, поэтому емкость берется от 2
+		capacity := 2 + rng.Intn(49)
+		rate := 0.1 + rng.Float64()*100
+		// Запросы приходят в среднем вчетверо чаще, чем разрешено
+		meanGap := time.Duration(float64(time.Second) / rate / 4)
+		horizon := time.Duration(float64(time.Second) * (50 + float64(capacity)) / rate)
+
+		limiter, clock := newTestLimiter(t, capacity, rate)
+		start := clock.Now()
+
+		var admitted []time.Time
+		for clock.Now().Sub(start) < horizon {
+			if limiter.Allow("client").Allowed {
+				admitted = append(admitted, clock.Now())
+			}
+			clock.Advance(time.Duration(rng.Int63n(int64(2*meanGap)) + 1))
+		}
+
+		elapsed := clock.Now().Sub(start).Seconds()
+		expected := float64(capacity) + rate*elapsed
+		assert.InDelta(t, expected, float64(len(admitted)), 2,
+			"capacity=%d rate=%.2f", capacity, rate)
+
+		// В любом окне длиной w пропущено не больше capacity + rate*w запросов
+		for first, last := 0, 0; first < len(admitted); first++ {
+			for last < len(admitted)-1 && admitted[last+1].Sub(admitted[first]) <= 10*time.Second {
+				last++
+			}
+			window := admitted[last].Sub(admitted[first]).Seconds()
+			if count := float64(last - first + 1); count > float64(capacity)+rate*window+1e-6 {
+				t.Fatalf("capacity=%d rate=%.2f: %v запросов за %.3fs", capacity, rate, count, window)
+			}
+		}
+	}
+}
+
+func TestClientIDIgnoresPort(t *testing.T) {
+	limiter, _ := newTestLimiter(t, 1, 0)
+	handler := RateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Новое соединение того же клиента не получает новое ведро
+	codes := make([]int, 0, 2)
+	for _, remoteAddr := range []string{"203.0.113.7:50001", "203.0.113.7:50002"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	assert.Equal(t, []int{http.StatusOK, http.StatusTooManyRequests}, codes)
+
+	_, exists := limiter.GetClientLimit("ip:203.0.113.7")
+	assert.True(t, exists)
+}
+
+// recordingLogger запоминает сообщения с полями
+type recordingLogger struct {
+	nopLogger
+	messages []string
+	fields   [][]interface{}
+}
+
+func (l *recordingLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.messages = append(l.messages, msg)
+	l.fields = append(l.fields, keysAndValues)
+}
+
+func TestRequestIDLoggedAsField(t *testing.T) {
+	log := &recordingLogger{}
+	requestLogger{Logger: log, requestID: "abc"}.Warnf("Превышен лимит запросов для клиента %s", "c1")
+
+	require.Len(t, log.messages, 1)
+	assert.Equal(t, "Превышен лимит запросов для клиента c1", log.messages[0])
+	assert.Equal(t, []interface{}{"request_id", "abc"}, log.fields[0])
+}
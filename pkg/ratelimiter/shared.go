@@ -0,0 +1,143 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+
+	"load-balancer/pkg/storage"
+)
+
+// minReservationTTL наименьшее время, в течение которого экземпляр расходует
+// зарезервированные токены. Более старый резерв отбрасывается: иначе после паузы
+// клиент получил бы полное общее ведро и вдобавок резерв
+const minReservationTTL = time.Second
+
+// SharedOptions настройки ограничения, общего для нескольких экземпляров
+type SharedOptions struct {
+	Store     storage.TokenStore
+	KeyPrefix string        // Префикс ключей ведер в хранилище
+	BatchSize int           // Токенов, резервируемых за одно обращение к хранилищу
+	Timeout   time.Duration // Таймаут обращения к хранилищу
+}
+
+// SharedTokenBucket ведро токенов в общем хранилище. Экземпляр резервирует токены
+// пачками по BatchSize и расходует их локально, обращаясь к хранилищу только
+// когда резерв исчерпан. Пока хранилище недоступно, клиента ограничивает
+// локальное ведро с теми же настройками
+type SharedTokenBucket struct {
+	options    SharedOptions
+	clientID   string
+	key        string
+	capacity   int
+	refillRate float64
+	reserved   int       // Зарезервированные и еще не израсходованные токены
+	expiresAt  time.Time // Время, после которого резерв отбрасывается
+	remaining  float64   // Остаток в общем ведре после последнего обращения
+	fallback   *TokenBucket
+	failing    bool // Хранилище было недоступно при последнем обращении
+	logger     Logger
+}
+
+// NewSharedTokenBucket создает ведро клиента clientID в общем хранилище
+func NewSharedTokenBucket(options SharedOptions, clientID string, capacity int, refillRate float64, now time.Time, logger Logger) *SharedTokenBucket {
+	if options.BatchSize <= 0 {
+		options.BatchSize = 1
+	}
+	return &SharedTokenBucket{
+		options:    options,
+		clientID:   clientID,
+		key:        options.KeyPrefix + clientID,
+		capacity:   capacity,
+		refillRate: refillRate,
+		remaining:  float64(capacity),
+		fallback:   NewTokenBucket(capacity, refillRate, now),
+		logger:     logger,
+	}
+}
+
+// Allow расходует зарезервированный токен или резервирует новую пачку
+func (b *SharedTokenBucket) Allow(now time.Time) Decision {
+	if b.reserved > 0 && now.After(b.expiresAt) {
+		b.reserved = 0
+	}
+
+	if b.reserved == 0 {
+		if err := b.reserve(now); err != nil {
+			if !b.failing {
+				b.logger.Warnf("Общее хранилище лимитов недоступно, клиент %s ограничивается локально: %v", b.clientID, err)
+				b.failing = true
+			}
+			return b.fallback.Allow(now)
+		}
+		if b.failing {
+			b.logger.Infof("Общее хранилище лимитов снова доступно")
+			b.failing = false
+		}
+	}
+
+	decision := Decision{Limit: b.capacity}
+	if b.reserved > 0 {
+		b.reserved--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = b.timeUntil(1)
+	}
+
+	decision.Remaining = int(b.remaining) + b.reserved
+	decision.Reset = b.timeUntil(float64(b.capacity))
+	return decision
+}
+
+// reserve списывает пачку токенов из общего ведра
+func (b *SharedTokenBucket) reserve(now time.Time) error {
+	ctx := context.Background()
+	if b.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.options.Timeout)
+		defer cancel()
+	}
+
+	batch := b.options.BatchSize
+	if batch > b.capacity {
+		batch = b.capacity
+	}
+
+	taken, remaining, err := b.options.Store.TakeTokens(ctx, b.key, b.capacity, b.refillRate, batch)
+	if err != nil {
+		return err
+	}
+	b.reserved = taken
+	b.expiresAt = now.Add(reservationTTL(batch, b.refillRate))
+	b.remaining = remaining
+	return nil
+}
+
+// reservationTTL возвращает время жизни резерва: за него общее ведро пополняется
+// на batch токенов, поэтому клиент, укладывающийся в лимит, успевает израсходовать
+// резерв и не теряет токены. При нулевой скорости резерв не устаревает
+func reservationTTL(batch int, refillRate float64) time.Duration {
+	ttl := windowFor(batch, refillRate)
+	if ttl < minReservationTTL {
+		return minReservationTTL
+	}
+	return ttl
+}
+
+// SetLimit меняет емкость и скорость; общее ведро применяет их при следующем обращении
+func (b *SharedTokenBucket) SetLimit(capacity int, refillRate float64, now time.Time) {
+	b.capacity = capacity
+	b.refillRate = refillRate
+	if b.reserved > capacity {
+		b.reserved = capacity
+	}
+	b.fallback.SetLimit(capacity, refillRate, now)
+}
+
+// timeUntil оценивает, через сколько в общем ведре будет tokens токенов
+func (b *SharedTokenBucket) timeUntil(tokens float64) time.Duration {
+	missing := tokens - b.remaining
+	if missing <= 0 || b.refillRate <= 0 {
+		return 0
+	}
+	return untilRecovery(secondsDuration(missing/b.refillRate), windowFor(b.capacity, b.refillRate))
+}
@@ -0,0 +1,153 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTokenStore общее хранилище ведер в памяти с часами теста
+type fakeTokenStore struct {
+	clock   *fakeClock
+	buckets map[string]*TokenBucket
+	calls   int
+	err     error
+}
+
+func newFakeTokenStore(clock *fakeClock) *fakeTokenStore {
+	return &fakeTokenStore{clock: clock, buckets: make(map[string]*TokenBucket)}
+}
+
+func (s *fakeTokenStore) TakeTokens(ctx context.Context, key string, capacity int, refillRate float64, n int) (int, float64, error) {
+	s.calls++
+	if s.err != nil {
+		return 0, 0, s.err
+	}
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = NewTokenBucket(capacity, refillRate, s.clock.Now())
+		s.buckets[key] = bucket
+	}
+	bucket.SetLimit(capacity, refillRate, s.clock.Now())
+
+	taken := n
+	if available := int(bucket.tokens); available < taken {
+		taken = available
+	}
+	bucket.tokens -= float64(taken)
+	return taken, bucket.tokens, nil
+}
+
+func (s *fakeTokenStore) Close() error { return nil }
+
+// newSharedLimiters создает ограничители нескольких экземпляров с общим хранилищем
+func newSharedLimiters(t *testing.T, count, capacity int, rate float64, batch int) ([]*RateLimiter, *fakeTokenStore, *fakeClock) {
+	t.Helper()
+	first, clock := newTestLimiter(t, capacity, rate)
+	store := newFakeTokenStore(clock)
+
+	limiters := []*RateLimiter{first}
+	for i := 1; i < count; i++ {
+		limiter, _ := newTestLimiter(t, capacity, rate)
+		limiter.now = clock.Now
+		limiters = append(limiters, limiter)
+	}
+	for _, limiter := range limiters {
+		limiter.SetShared(SharedOptions{Store: store, KeyPrefix: "test:", BatchSize: batch})
+	}
+	return limiters, store, clock
+}
+
+func TestSharedLimitAcrossInstances(t *testing.T) {
+	limiters, store, clock := newSharedLimiters(t, 3, 10, 1, 1)
+
+	// Три экземпляра вместе пропускают емкость одного ведра, а не втрое больше
+	admitted := 0
+	for i := 0; i < 30; i++ {
+		if limiters[i%3].Allow("client").Allowed {
+			admitted++
+		}
+	}
+	assert.Equal(t, 10, admitted)
+	assert.Contains(t, store.buckets, "test:client")
+
+	decision := limiters[0].Allow("client")
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, time.Second, decision.RetryAfter)
+
+	clock.Advance(time.Second)
+	assert.True(t, limiters[1].Allow("client").Allowed)
+}
+
+func TestSharedBatching(t *testing.T) {
+	limiters, store, clock := newSharedLimiters(t, 2, 20, 1, 5)
+
+	for i := 0; i < 5; i++ {
+		require.True(t, limiters[0].Allow("client").Allowed)
+	}
+	assert.Equal(t, 1, store.calls, "пачка из 5 токенов резервируется одним обращением")
+
+	// Резерв одного экземпляра уменьшает общее ведро для остальных
+	for i := 0; i < 15; i++ {
+		require.True(t, limiters[1].Allow("client").Allowed)
+	}
+	assert.False(t, limiters[1].Allow("client").Allowed)
+	assert.Equal(t, 5, store.calls)
+
+	assert.False(t, limiters[0].Allow("client").Allowed)
+
+	// После пополнения экземпляр снова резервирует пачку, а устаревший
+	// резерв (старше batch/refill_rate = 5 секунд) отбрасывает и обращается к хранилищу
+	clock.Advance(5 * time.Second)
+	require.True(t, limiters[0].Allow("client").Allowed)
+	clock.Advance(6 * time.Second)
+	calls := store.calls
+	limiters[0].Allow("client")
+	assert.Equal(t, calls+1, store.calls)
+}
+
+func TestSharedSlowClient(t *testing.T) {
+	limiters, store, clock := newSharedLimiters(t, 2, 10, 1, 5)
+
+	// Клиент шлет по запросу на каждую реплику раз в 3.2 секунды, медленнее лимита.
+	// Резерв живет batch/refill_rate = 5 секунд и расходуется, а не отбрасывается
+	// после первого же запроса, поэтому общее ведро не пустеет
+	for i := 0; i < 100; i++ {
+		for _, limiter := range limiters {
+			require.True(t, limiter.Allow("client").Allowed, "запрос %d", i)
+			clock.Advance(100 * time.Millisecond)
+		}
+		clock.Advance(3 * time.Second)
+	}
+	assert.Less(t, store.calls, 200, "резерв расходуется несколькими запросами")
+
+	assert.Equal(t, time.Second, reservationTTL(1, 10))
+	assert.Equal(t, 5*time.Second, reservationTTL(5, 1))
+	assert.Equal(t, foreverWindow, reservationTTL(5, 0))
+}
+
+func TestSharedFallback(t *testing.T) {
+	limiters, store, _ := newSharedLimiters(t, 1, 2, 0, 1)
+	store.err = errors.New("connection refused")
+
+	// Пока хранилище недоступно, действует локальное ведро с теми же настройками
+	assert.True(t, limiters[0].Allow("client").Allowed)
+	assert.True(t, limiters[0].Allow("client").Allowed)
+	assert.False(t, limiters[0].Allow("client").Allowed)
+
+	store.err = nil
+	assert.True(t, limiters[0].Allow("client").Allowed)
+}
+
+func TestSharedOnlyTokenBucket(t *testing.T) {
+	limiters, store, _ := newSharedLimiters(t, 1, 2, 1, 1)
+	require.NoError(t, limiters[0].SetClientLimitWithAlgorithm("windowed", FixedWindowAlgorithm, 2, 1))
+
+	limiters[0].Allow("windowed")
+	assert.Zero(t, store.calls)
+}
@@ -0,0 +1,90 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+
+	"load-balancer/pkg/clientip"
+)
+
+// Header заголовок с идентификатором запроса
+const Header = "X-Request-ID"
+
+// maxLength ограничивает длину принятого от клиента идентификатора
+const maxLength = 128
+
+// contextKey ключ идентификатора в контексте запроса
+type contextKey struct{}
+
+// New генерирует случайный идентификатор запроса
+func New() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// NewContext возвращает контекст с идентификатором запроса
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext возвращает идентификатор запроса или пустую строку
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Options определяет, каким входящим идентификаторам можно доверять
+type Options struct {
+	TrustIncoming   bool         // Принимать X-Request-ID от клиента
+	TrustedNetworks []*net.IPNet // Сети, от которых принимается X-Request-ID (см. clientip.ParseNetworks); пусто - от любых
+}
+
+// Middleware назначает запросу идентификатор: принимает входящий, если ему можно
+// доверять, или генерирует новый. Идентификатор передается бэкенду в заголовке
+// запроса и возвращается клиенту в заголовке ответа
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(Header)
+			if id == "" || !opts.trusted(r) || !valid(id) {
+				id = New()
+			}
+
+			r.Header.Set(Header, id)
+			w.Header().Set(Header, id)
+
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+		})
+	}
+}
+
+// trusted проверяет, можно ли принять идентификатор от источника запроса
+func (o Options) trusted(r *http.Request) bool {
+	if !o.TrustIncoming {
+		return false
+	}
+	if len(o.TrustedNetworks) == 0 {
+		return true
+	}
+
+	ip := clientip.PeerIP(r)
+	return ip != nil && clientip.Contains(o.TrustedNetworks, ip)
+}
+
+// valid допускает только печатные символы без пробелов, чтобы идентификатор
+// можно было безопасно писать в логи и заголовки
+func valid(id string) bool {
+	if len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' || id[i] == '"' || id[i] == '\\' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"load-balancer/pkg/clientip"
+)
+
+func TestMiddleware(t *testing.T) {
+	networks, err := clientip.ParseNetworks([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	var seen, forwarded string
+	handler := Middleware(Options{TrustIncoming: true, TrustedNetworks: networks})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = FromContext(r.Context())
+			forwarded = r.Header.Get(Header)
+		}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		incoming   string
+		keep       bool
+	}{
+		{"trusted network", "10.1.2.3:5000", "abc-123", true},
+		{"ipv4-mapped peer", "[::ffff:10.1.2.3]:5000", "abc-123", true},
+		{"untrusted network", "192.168.1.1:5000", "abc-123", false},
+		{"invalid value", "10.1.2.3:5000", "bad id\n", false},
+		{"missing", "10.1.2.3:5000", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.incoming != "" {
+				req.Header.Set(Header, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			require.NotEmpty(t, seen)
+			assert.Equal(t, seen, forwarded)
+			assert.Equal(t, seen, rec.Header().Get(Header))
+			if tt.keep {
+				assert.Equal(t, tt.incoming, seen)
+			} else {
+				assert.NotEqual(t, tt.incoming, seen)
+				assert.Len(t, seen, 32)
+			}
+		})
+	}
+}
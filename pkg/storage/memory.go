@@ -1,46 +1,43 @@
 package storage
 
 import (
+	"context"
 	"sync"
 )
 
 // MemoryStorage реализует хранилище в памяти
 type MemoryStorage struct {
-	limits map[string]ClientLimit
-	mutex  sync.RWMutex
+	limits   map[string]ClientLimit
+	backends map[string]Backend
+	order    []string // Порядок добавления бэкендов
+	mutex    sync.RWMutex
 }
 
 // NewMemoryStorage создает новое хранилище в памяти
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		limits: make(map[string]ClientLimit),
+		limits:   make(map[string]ClientLimit),
+		backends: make(map[string]Backend),
 	}
 }
 
 // SaveClientLimit сохраняет настройки лимита для клиента
-func (s *MemoryStorage) SaveClientLimit(clientID string, capacity int, refillRate float64) error {
+func (s *MemoryStorage) SaveClientLimit(clientID string, limit ClientLimit) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	s.limits[clientID] = ClientLimit{
-		Capacity:   capacity,
-		RefillRate: refillRate,
-	}
+	s.limits[clientID] = limit
 
 	return nil
 }
 
 // GetClientLimit получает настройки лимита для клиента
-func (s *MemoryStorage) GetClientLimit(clientID string) (capacity int, refillRate float64, exists bool, err error) {
+func (s *MemoryStorage) GetClientLimit(clientID string) (limit ClientLimit, exists bool, err error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
-	limit, exists := s.limits[clientID]
-	if !exists {
-		return 0, 0, false, nil
-	}
-
-	return limit.Capacity, limit.RefillRate, true, nil
+	limit, exists = s.limits[clientID]
+	return limit, exists, nil
 }
 
 // LoadAllClientLimits загружает все настройки лимитов
@@ -65,6 +62,56 @@ func (s *MemoryStorage) DeleteClientLimit(clientID string) error {
 	return nil
 }
 
+// SaveBackend сохраняет бэкенд пула
+func (s *MemoryStorage) SaveBackend(backend Backend) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.backends[backend.URL]; !exists {
+		s.order = append(s.order, backend.URL)
+	}
+	s.backends[backend.URL] = backend
+
+	return nil
+}
+
+// LoadAllBackends загружает бэкенды пула в порядке добавления
+func (s *MemoryStorage) LoadAllBackends() ([]Backend, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	backends := make([]Backend, 0, len(s.order))
+	for _, url := range s.order {
+		backends = append(backends, s.backends[url])
+	}
+
+	return backends, nil
+}
+
+// DeleteBackend удаляет бэкенд пула
+func (s *MemoryStorage) DeleteBackend(url string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.backends[url]; !exists {
+		return nil
+	}
+	delete(s.backends, url)
+
+	for i, u := range s.order {
+		if u == url {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Ping проверяет доступность хранилища; хранилище в памяти доступно всегда
+func (s *MemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
 // Close закрывает хранилище
 func (s *MemoryStorage) Close() error {
 	return nil
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
@@ -54,6 +55,14 @@ func NewPostgresStorage(config Config) (*PostgresStorage, error) {
 	return storage, nil
 }
 
+// Ping проверяет соединение с БД
+func (s *PostgresStorage) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("ошибка проверки соединения с PostgreSQL: %w", err)
+	}
+	return nil
+}
+
 // Close закрывает соединение с БД
 func (s *PostgresStorage) Close() error {
 	return s.db.Close()
@@ -68,22 +77,40 @@ func (s *PostgresStorage) initSchema() error {
 			refill_rate FLOAT NOT NULL,
 			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
 			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);
+
+		ALTER TABLE rate_limits ADD COLUMN IF NOT EXISTS algorithm VARCHAR(32) NOT NULL DEFAULT '';
+
+		CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+			key VARCHAR(512) PRIMARY KEY,
+			tokens DOUBLE PRECISION NOT NULL,
+			taken INTEGER NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS backends (
+			url VARCHAR(2048) PRIMARY KEY,
+			weight INTEGER NOT NULL,
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
 		)
 	`)
 	return err
 }
 
 // SaveClientLimit сохраняет настройки лимита для клиента
-func (s *PostgresStorage) SaveClientLimit(clientID string, capacity int, refillRate float64) error {
+func (s *PostgresStorage) SaveClientLimit(clientID string, limit ClientLimit) error {
 	_, err := s.db.Exec(`
-		INSERT INTO rate_limits (client_id, capacity, refill_rate, updated_at)
-		VALUES ($1, $2, $3, NOW())
+		INSERT INTO rate_limits (client_id, capacity, refill_rate, algorithm, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
 		ON CONFLICT (client_id) 
 		DO UPDATE SET 
 			capacity = $2,
 			refill_rate = $3,
+			algorithm = $4,
 			updated_at = NOW()
-	`, clientID, capacity, refillRate)
+	`, clientID, limit.Capacity, limit.RefillRate, limit.Algorithm)
 
 	if err != nil {
 		return fmt.Errorf("ошибка сохранения лимита: %w", err)
@@ -92,26 +119,26 @@ func (s *PostgresStorage) SaveClientLimit(clientID string, capacity int, refillR
 }
 
 // GetClientLimit получает настройки лимита для клиента
-func (s *PostgresStorage) GetClientLimit(clientID string) (capacity int, refillRate float64, exists bool, err error) {
+func (s *PostgresStorage) GetClientLimit(clientID string) (limit ClientLimit, exists bool, err error) {
 	row := s.db.QueryRow(`
-		SELECT capacity, refill_rate FROM rate_limits
+		SELECT capacity, refill_rate, algorithm FROM rate_limits
 		WHERE client_id = $1
 	`, clientID)
 
-	err = row.Scan(&capacity, &refillRate)
+	err = row.Scan(&limit.Capacity, &limit.RefillRate, &limit.Algorithm)
 	if err == sql.ErrNoRows {
-		return 0, 0, false, nil
+		return ClientLimit{}, false, nil
 	}
 	if err != nil {
-		return 0, 0, false, fmt.Errorf("ошибка получения лимита: %w", err)
+		return ClientLimit{}, false, fmt.Errorf("ошибка получения лимита: %w", err)
 	}
-	return capacity, refillRate, true, nil
+	return limit, true, nil
 }
 
 // LoadAllClientLimits загружает все настройки лимитов
 func (s *PostgresStorage) LoadAllClientLimits() (map[string]ClientLimit, error) {
 	rows, err := s.db.Query(`
-		SELECT client_id, capacity, refill_rate FROM rate_limits
+		SELECT client_id, capacity, refill_rate, algorithm FROM rate_limits
 	`)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка загрузки лимитов: %w", err)
@@ -121,15 +148,11 @@ func (s *PostgresStorage) LoadAllClientLimits() (map[string]ClientLimit, error)
 	limits := make(map[string]ClientLimit)
 	for rows.Next() {
 		var clientID string
-		var capacity int
-		var refillRate float64
-		if err := rows.Scan(&clientID, &capacity, &refillRate); err != nil {
+		var limit ClientLimit
+		if err := rows.Scan(&clientID, &limit.Capacity, &limit.RefillRate, &limit.Algorithm); err != nil {
 			return nil, fmt.Errorf("ошибка сканирования строки: %w", err)
 		}
-		limits[clientID] = ClientLimit{
-			Capacity:   capacity,
-			RefillRate: refillRate,
-		}
+		limits[clientID] = limit
 	}
 
 	if err := rows.Err(); err != nil {
@@ -149,3 +172,87 @@ func (s *PostgresStorage) DeleteClientLimit(clientID string) error {
 	}
 	return nil
 }
+
+// SaveBackend сохраняет бэкенд пула
+func (s *PostgresStorage) SaveBackend(backend Backend) error {
+	_, err := s.db.Exec(`
+		INSERT INTO backends (url, weight, enabled, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (url)
+		DO UPDATE SET
+			weight = $2,
+			enabled = $3,
+			updated_at = NOW()
+	`, backend.URL, backend.Weight, backend.Enabled)
+
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения бэкенда: %w", err)
+	}
+	return nil
+}
+
+// LoadAllBackends загружает бэкенды пула в порядке добавления
+func (s *PostgresStorage) LoadAllBackends() ([]Backend, error) {
+	rows, err := s.db.Query(`
+		SELECT url, weight, enabled FROM backends
+		ORDER BY created_at, url
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки бэкендов: %w", err)
+	}
+	defer rows.Close()
+
+	var backends []Backend
+	for rows.Next() {
+		var backend Backend
+		if err := rows.Scan(&backend.URL, &backend.Weight, &backend.Enabled); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования строки: %w", err)
+		}
+		backends = append(backends, backend)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+	return backends, nil
+}
+
+// DeleteBackend удаляет бэкенд пула
+func (s *PostgresStorage) DeleteBackend(url string) error {
+	_, err := s.db.Exec(`
+		DELETE FROM backends WHERE url = $1
+	`, url)
+
+	if err != nil {
+		return fmt.Errorf("ошибка удаления бэкенда: %w", err)
+	}
+	return nil
+}
+
+// refilledTokens токены ведра после пополнения за время с прошлого обращения
+const refilledTokens = `LEAST($2::float8, rate_limit_buckets.tokens +
+	GREATEST(0, EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)) * $3::float8)`
+
+// takeTokensQuery пополняет и списывает токены одной командой: ON CONFLICT DO UPDATE
+// блокирует строку, поэтому одновременные обращения нескольких экземпляров
+// выполняются по очереди. Выражения SET вычисляются по старой строке
+const takeTokensQuery = `
+	INSERT INTO rate_limit_buckets (key, tokens, taken, updated_at)
+	VALUES ($1, $2::float8 - LEAST($4::int, FLOOR($2::float8)), LEAST($4::int, FLOOR($2::float8)), now())
+	ON CONFLICT (key) DO UPDATE SET
+		tokens = ` + refilledTokens + ` - LEAST($4::int, FLOOR(` + refilledTokens + `)),
+		taken = LEAST($4::int, FLOOR(` + refilledTokens + `)),
+		updated_at = GREATEST(now(), rate_limit_buckets.updated_at)
+	RETURNING taken, tokens
+`
+
+// TakeTokens пополняет ведро key и списывает из него до n токенов
+func (s *PostgresStorage) TakeTokens(ctx context.Context, key string, capacity int, refillRate float64, n int) (int, float64, error) {
+	var taken int
+	var remaining float64
+	err := s.db.QueryRowContext(ctx, takeTokensQuery, key, float64(capacity), refillRate, n).Scan(&taken, &remaining)
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка списания токенов: %w", err)
+	}
+	return taken, remaining, nil
+}
@@ -0,0 +1,328 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisConfig содержит настройки подключения к Redis
+type RedisConfig struct {
+	Address  string
+	Password string
+	DB       int
+	PoolSize int           // Количество простаивающих соединений, сохраняемых для повторного использования
+	Timeout  time.Duration // Таймаут подключения и команды, если в контексте нет дедлайна
+}
+
+// takeTokensScript пополняет ведро по часам Redis и списывает до n токенов.
+// Скрипт выполняется атомарно, поэтому экземпляры не могут списать один токен дважды.
+// Ключ живет, пока ведро не наполнится
+const takeTokensScript = `
+redis.replicate_commands()
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local taken = math.min(n, math.floor(tokens))
+tokens = tokens - taken
+
+redis.call('HSET', KEYS[1], 'tokens', string.format('%.17g', tokens), 'ts', string.format('%.6f', math.max(now, ts)))
+if rate > 0 then
+	redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate * 1000) + 1000)
+end
+return {taken, string.format('%.17g', tokens)}
+`
+
+// takeTokensSHA хеш скрипта для EVALSHA
+var takeTokensSHA = func() string {
+	sum := sha1.Sum([]byte(takeTokensScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// RedisTokenStore хранит ведра токенов в Redis. Клиент говорит на протоколе RESP
+// напрямую и поддерживает только команды, нужные ограничителю
+type RedisTokenStore struct {
+	config RedisConfig
+	idle   chan *redisConn
+	closed bool
+	mutex  sync.Mutex
+}
+
+// NewRedisTokenStore подключается к Redis и проверяет соединение
+func NewRedisTokenStore(config RedisConfig) (*RedisTokenStore, error) {
+	if config.PoolSize <= 0 {
+		config.PoolSize = 10
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second
+	}
+
+	store := &RedisTokenStore{
+		config: config,
+		idle:   make(chan *redisConn, config.PoolSize),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	conn, err := store.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.do(ctx, config.Timeout, "PING"); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ошибка проверки соединения с Redis: %w", err)
+	}
+	store.put(conn)
+
+	return store, nil
+}
+
+// TakeTokens пополняет ведро key и списывает из него до n токенов
+func (s *RedisTokenStore) TakeTokens(ctx context.Context, key string, capacity int, refillRate float64, n int) (int, float64, error) {
+	args := []string{
+		"1", key,
+		strconv.Itoa(capacity),
+		strconv.FormatFloat(refillRate, 'g', -1, 64),
+		strconv.Itoa(n),
+	}
+
+	// Скрипт передается целиком, только если Redis его еще не кэшировал
+	reply, err := s.do(ctx, append([]string{"EVALSHA", takeTokensSHA}, args...)...)
+	var replyErr redisError
+	if errors.As(err, &replyErr) && strings.HasPrefix(string(replyErr), "NOSCRIPT") {
+		reply, err = s.do(ctx, append([]string{"EVAL", takeTokensScript}, args...)...)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка списания токенов: %w", err)
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, 0, fmt.Errorf("неожиданный ответ Redis: %v", reply)
+	}
+	taken, ok := values[0].(int64)
+	if !ok {
+		return 0, 0, fmt.Errorf("неожиданный ответ Redis: %v", reply)
+	}
+	tokens, _ := values[1].(string)
+	remaining, err := strconv.ParseFloat(tokens, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("неожиданный ответ Redis: %v", reply)
+	}
+	return int(taken), remaining, nil
+}
+
+// Ping проверяет соединение с Redis
+func (s *RedisTokenStore) Ping(ctx context.Context) error {
+	if _, err := s.do(ctx, "PING"); err != nil {
+		return fmt.Errorf("ошибка проверки соединения с Redis: %w", err)
+	}
+	return nil
+}
+
+// Close закрывает простаивающие соединения; соединения, занятые командами,
+// закрываются по их завершении
+func (s *RedisTokenStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.idle)
+	for conn := range s.idle {
+		conn.Close()
+	}
+	return nil
+}
+
+// do выполняет команду на соединении из пула
+func (s *RedisTokenStore) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.do(ctx, s.config.Timeout, args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// После сетевой ошибки состояние соединения неизвестно
+		conn.Close()
+		return nil, err
+	}
+	s.put(conn)
+	return reply, err
+}
+
+// get берет простаивающее соединение или открывает новое
+func (s *RedisTokenStore) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn, ok := <-s.idle:
+		if ok {
+			return conn, nil
+		}
+		return nil, errors.New("хранилище Redis закрыто")
+	default:
+		return s.dial(ctx)
+	}
+}
+
+// put возвращает соединение в пул или закрывает его, если пул заполнен
+func (s *RedisTokenStore) put(conn *redisConn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		conn.Close()
+		return
+	}
+	select {
+	case s.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// dial открывает соединение, выполняя аутентификацию и выбор базы
+func (s *RedisTokenStore) dial(ctx context.Context) (*redisConn, error) {
+	dialer := net.Dialer{Timeout: s.config.Timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", s.config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к Redis: %w", err)
+	}
+
+	conn := &redisConn{
+		Conn:   netConn,
+		reader: bufio.NewReader(netConn),
+		writer: bufio.NewWriter(netConn),
+	}
+
+	if s.config.Password != "" {
+		if _, err := conn.do(ctx, s.config.Timeout, "AUTH", s.config.Password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ошибка аутентификации в Redis: %w", err)
+		}
+	}
+	if s.config.DB != 0 {
+		if _, err := conn.do(ctx, s.config.Timeout, "SELECT", strconv.Itoa(s.config.DB)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ошибка выбора базы Redis: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// redisError ошибка, которую вернул Redis; соединение после нее остается рабочим
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// redisConn соединение с Redis
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// do отправляет команду и читает ответ. Дедлайн берется из контекста, а без
+// него ограничивается таймаутом
+func (c *redisConn) do(ctx context.Context, timeout time.Duration, args ...string) (interface{}, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(timeout)
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	// Команда передается массивом bulk-строк
+	fmt.Fprintf(c.writer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.writer, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	return readReply(c.reader)
+}
+
+// readReply читает ответ в формате RESP2
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("некорректный ответ Redis: %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный ответ Redis: %q", line)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный ответ Redis: %q", line)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, count)
+		for i := range values {
+			// Ошибка внутри массива не прерывает чтение остальных элементов
+			value, err := readReply(r)
+			var replyErr redisError
+			if errors.As(err, &replyErr) {
+				value = replyErr
+			} else if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("некорректный ответ Redis: %q", line)
+	}
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis сервер RESP, выполняющий команды, которые отправляет RedisTokenStore.
+// Скрипт списания эмулируется без пополнения
+type fakeRedis struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	tokens   map[string]float64
+	scripts  bool // Скрипт загружен командой EVAL
+	commands []string
+}
+
+func startFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeRedis{listener: listener, tokens: make(map[string]float64)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		request, err := readReply(reader)
+		if err != nil {
+			return
+		}
+		args := request.([]interface{})
+		fmt.Fprint(conn, s.handle(args))
+	}
+}
+
+func (s *fakeRedis) handle(args []interface{}) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	command := args[0].(string)
+	s.commands = append(s.commands, command)
+	switch command {
+	case "PING":
+		return "+PONG\r\n"
+	case "EVALSHA":
+		if !s.scripts {
+			return "-NOSCRIPT No matching script\r\n"
+		}
+	case "EVAL":
+		s.scripts = true
+	default:
+		return "-ERR unknown command\r\n"
+	}
+
+	key := args[3].(string)
+	capacity, _ := strconv.ParseFloat(args[4].(string), 64)
+	n, _ := strconv.Atoi(args[6].(string))
+	tokens, ok := s.tokens[key]
+	if !ok {
+		tokens = capacity
+	}
+	taken := math.Min(float64(n), math.Floor(tokens))
+	s.tokens[key] = tokens - taken
+
+	remaining := strconv.FormatFloat(tokens-taken, 'g', -1, 64)
+	return fmt.Sprintf("*2\r\n:%d\r\n$%d\r\n%s\r\n", int(taken), len(remaining), remaining)
+}
+
+func TestRedisTokenStoreProtocol(t *testing.T) {
+	server := startFakeRedis(t)
+	store, err := NewRedisTokenStore(RedisConfig{Address: server.listener.Addr().String(), Timeout: time.Second})
+	require.NoError(t, err)
+	defer store.Close()
+
+	ctx := context.Background()
+	taken, remaining, err := store.TakeTokens(ctx, "client", 5, 1, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 3, taken)
+	assert.Equal(t, 2.0, remaining)
+
+	taken, remaining, err = store.TakeTokens(ctx, "client", 5, 1, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 2, taken)
+	assert.Equal(t, 0.0, remaining)
+
+	// Скрипт передается целиком только после NOSCRIPT
+	assert.Equal(t, []string{"PING", "EVALSHA", "EVAL", "EVALSHA"}, server.commands)
+	assert.NoError(t, store.Ping(ctx))
+}
+
+func TestReadReply(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("*3\r\n$-1\r\n-ERR boom\r\n*1\r\n+OK\r\n"))
+	reply, err := readReply(reader)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{nil, redisError("ERR boom"), []interface{}{"OK"}}, reply)
+
+	_, err = readReply(bufio.NewReader(strings.NewReader("?\r\n")))
+	assert.Error(t, err)
+}
+
+// TestRedisTokenStoreConcurrent проверяет скрипт на настоящем Redis: адрес берется
+// из REDIS_ADDR, иначе запускается redis-server из PATH
+func TestRedisTokenStoreConcurrent(t *testing.T) {
+	store, err := NewRedisTokenStore(RedisConfig{Address: redisAddr(t), Timeout: time.Second})
+	require.NoError(t, err)
+	defer store.Close()
+
+	key := fmt.Sprintf("test:%d", time.Now().UnixNano())
+	var total int
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				taken, _, err := store.TakeTokens(context.Background(), key, 50, 0.001, 1)
+				assert.NoError(t, err)
+				mutex.Lock()
+				total += taken
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Из 200 попыток проходят ровно 50: токен не списывается дважды
+	assert.Equal(t, 50, total)
+}
+
+// redisAddr возвращает адрес Redis для теста или пропускает тест
+func redisAddr(t *testing.T) string {
+	t.Helper()
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		return addr
+	}
+	if testing.Short() {
+		t.Skip("интеграционный тест Redis пропущен в режиме -short")
+	}
+	path, err := exec.LookPath("redis-server")
+	if err != nil {
+		t.Skip("redis-server не найден, задайте REDIS_ADDR")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	cmd := exec.Command(path, "--port", strconv.Itoa(port), "--save", "", "--appendonly", "no")
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	return addr
+}
@@ -1,16 +1,40 @@
 package storage
 
+import "context"
+
 // ClientLimit структура для хранения настроек лимита
 type ClientLimit struct {
+	Algorithm  string // Алгоритм ограничения; пустой у записей, сохраненных до появления выбора алгоритма
 	Capacity   int
 	RefillRate float64
 }
 
+// Backend структура для хранения бэкенда из пула балансировщика
+type Backend struct {
+	URL     string
+	Weight  int
+	Enabled bool
+}
+
 // Storage интерфейс для хранения настроек
 type Storage interface {
-	SaveClientLimit(clientID string, capacity int, refillRate float64) error
-	GetClientLimit(clientID string) (capacity int, refillRate float64, exists bool, err error)
+	SaveClientLimit(clientID string, limit ClientLimit) error
+	GetClientLimit(clientID string) (limit ClientLimit, exists bool, err error)
 	LoadAllClientLimits() (map[string]ClientLimit, error)
 	DeleteClientLimit(clientID string) error
+	SaveBackend(backend Backend) error
+	LoadAllBackends() ([]Backend, error)
+	DeleteBackend(url string) error
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// TokenStore хранит ведра токенов, общие для нескольких экземпляров балансировщика.
+// Время пополнения берется из часов хранилища, поэтому расхождение часов
+// экземпляров не влияет на лимит
+type TokenStore interface {
+	// TakeTokens пополняет ведро key и списывает из него до n токенов. Возвращает
+	// число списанных токенов и остаток в ведре
+	TakeTokens(ctx context.Context, key string, capacity int, refillRate float64, n int) (taken int, remaining float64, err error)
 	Close() error
 }